@@ -0,0 +1,59 @@
+// Command webhooksink is a local receiver for testing webhook subscriptions:
+// it verifies signatures, logs every delivery and answers with a configurable
+// status code.
+//
+//	go run ./cmd/webhooksink -addr :9090 -secret whsec_...
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "listen address")
+	secret := flag.String("secret", "", "subscription secret; signatures aren't checked if empty")
+	tolerance := flag.Duration("tolerance", 5*time.Minute, "maximum age of a signature")
+	status := flag.Int("status", http.StatusNoContent, "status code to answer deliveries with")
+	flag.Parse()
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		verified := "unchecked"
+		if *secret != "" {
+			signedAt, ok := webhook.Verify(*secret, r.Header.Get(webhook.SignatureHeader), body)
+			switch {
+			case !ok:
+				verified = "INVALID"
+			case time.Since(signedAt) > *tolerance:
+				verified = "STALE"
+			default:
+				verified = "valid"
+			}
+		}
+
+		log.Printf(
+			"%s %s delivery=%s signature=%s -> %d\n%s",
+			r.Method,
+			r.Header.Get(webhook.EventHeader),
+			r.Header.Get(webhook.DeliveryHeader),
+			verified,
+			*status,
+			body,
+		)
+		w.WriteHeader(*status)
+	})
+
+	log.Printf("Listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, nil))
+}
@@ -0,0 +1,336 @@
+// Package aggregate joins auth and event data into gateway responses, so
+// clients can ask for ?expand=creator,attendees instead of making N+1 calls.
+//
+// The auth service only tells whether a user is an admin, so a joined user
+// has no profile fields besides its ID and role.
+package aggregate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	authpb "github.com/Estriper0/protobuf/gen/auth"
+	eventpb "github.com/Estriper0/protobuf/gen/event"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Expansions supported by the aggregator.
+const (
+	Creator   = "creator"
+	Attendees = "attendees"
+	Users     = "users"
+)
+
+var ErrBudgetExhausted = errors.New("no time left to expand the response")
+
+type User struct {
+	ID      string `json:"id"`
+	IsAdmin bool   `json:"is_admin"`
+}
+
+// Ref is an event whose creator and attendees can be joined.
+type Ref struct {
+	ID      int64
+	Creator string
+}
+
+// Failure annotates a joined entity that could not be fetched. Path is the
+// location of the entity in Result, e.g. "attendees.3" or "users.<uuid>".
+type Failure struct {
+	Path    string `json:"path"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Result holds the joined entities keyed by the IDs used in the response.
+type Result struct {
+	Creator   map[string]User   `json:"creator,omitempty"`
+	Attendees map[string][]User `json:"attendees,omitempty"`
+	Users     map[string]User   `json:"users,omitempty"`
+	Failures  []Failure         `json:"-"`
+
+	mu sync.Mutex
+}
+
+func (r *Result) fail(path string, err error) {
+	code, message := Status(err)
+	r.mu.Lock()
+	r.Failures = append(r.Failures, Failure{Path: path, Code: code, Message: message})
+	r.mu.Unlock()
+}
+
+type Aggregator struct {
+	config    config.Expand
+	auth      authpb.AuthClient
+	events    eventpb.EventClient
+	users     *lru[string, User]
+	attendees *lru[int64, []string]
+}
+
+func New(config config.Expand, auth authpb.AuthClient, events eventpb.EventClient) *Aggregator {
+	return &Aggregator{
+		config:    config,
+		auth:      auth,
+		events:    events,
+		users:     newLRU[string, User](config.MaxEntries, config.UserTTL),
+		attendees: newLRU[int64, []string](config.MaxEntries, config.AttendeesTTL),
+	}
+}
+
+// Parse validates a comma-separated ?expand= value against the expansions
+// the endpoint supports.
+func Parse(raw string, allowed ...string) ([]string, error) {
+	var fields []string
+	for field := range strings.SplitSeq(raw, ",") {
+		field = strings.TrimSpace(field)
+		if !slices.Contains(allowed, field) {
+			return nil, fmt.Errorf("expand must be a comma-separated list of: %s", strings.Join(allowed, ", "))
+		}
+		if !slices.Contains(fields, field) {
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// Forget drops the cached attendees of an event after a registration change.
+func (a *Aggregator) Forget(eventID int64) {
+	a.attendees.delete(eventID)
+}
+
+// Events joins the requested expansions for the events. Attendees are only
+// joined if showAttendees is set, otherwise they are reported as forbidden.
+// Failures never fail the whole result.
+func (a *Aggregator) Events(ctx context.Context, fields []string, refs []Ref, showAttendees bool) *Result {
+	ctx, cancel := a.budget(ctx)
+	defer cancel()
+
+	result := &Result{}
+	var wg sync.WaitGroup
+
+	if slices.Contains(fields, Creator) {
+		result.Creator = make(map[string]User)
+		creators := make([]string, 0, len(refs))
+		for _, ref := range refs {
+			if ref.Creator != "" && !slices.Contains(creators, ref.Creator) {
+				creators = append(creators, ref.Creator)
+			}
+		}
+		wg.Go(func() {
+			a.resolve(ctx, result, result.Creator, Creator, creators)
+		})
+	}
+
+	if slices.Contains(fields, Attendees) {
+		result.Attendees = make(map[string][]User, len(refs))
+		wg.Go(func() {
+			a.joinAttendees(ctx, result, refs, showAttendees)
+		})
+	}
+
+	wg.Wait()
+	return result
+}
+
+// Users joins the users with the given IDs.
+func (a *Aggregator) Users(ctx context.Context, ids []string) *Result {
+	ctx, cancel := a.budget(ctx)
+	defer cancel()
+
+	result := &Result{Users: make(map[string]User, len(ids))}
+	a.resolve(ctx, result, result.Users, Users, ids)
+	return result
+}
+
+func (a *Aggregator) joinAttendees(ctx context.Context, result *Result, refs []Ref, allowed bool) {
+	if !allowed {
+		for _, ref := range refs {
+			result.fail(Attendees+"."+strconv.FormatInt(ref.ID, 10), status.Error(codes.PermissionDenied, "The user does not have access to the requested resource."))
+		}
+		return
+	}
+
+	ids := make([]int64, len(refs))
+	for i, ref := range refs {
+		ids[i] = ref.ID
+	}
+	attendees, errs := a.attendeesOf(ctx, ids)
+	for id, err := range errs {
+		result.fail(Attendees+"."+strconv.FormatInt(id, 10), err)
+	}
+	result.mu.Lock()
+	for id, users := range attendees {
+		result.Attendees[strconv.FormatInt(id, 10)] = users
+	}
+	result.mu.Unlock()
+}
+
+// AttendeesOf returns the attendees of the events. Attendees whose user could
+// not be fetched are left out.
+func (a *Aggregator) AttendeesOf(ctx context.Context, eventIDs []int64) (map[int64][]User, map[int64]error) {
+	ctx, cancel := a.budget(ctx)
+	defer cancel()
+
+	return a.attendeesOf(ctx, eventIDs)
+}
+
+func (a *Aggregator) attendeesOf(ctx context.Context, eventIDs []int64) (map[int64][]User, map[int64]error) {
+	lists := make([][]string, len(eventIDs))
+	errs := make(map[int64]error)
+	var mu sync.Mutex
+	a.each(len(eventIDs), func(i int) {
+		ids, err := a.attendeeIDs(ctx, eventIDs[i])
+		if err != nil {
+			mu.Lock()
+			errs[eventIDs[i]] = err
+			mu.Unlock()
+			return
+		}
+		lists[i] = ids
+	})
+
+	var all []string
+	for _, ids := range lists {
+		for _, id := range ids {
+			if !slices.Contains(all, id) {
+				all = append(all, id)
+			}
+		}
+	}
+	users, _ := a.lookup(ctx, all)
+
+	attendees := make(map[int64][]User, len(eventIDs))
+	for i, id := range eventIDs {
+		if _, failed := errs[id]; failed {
+			continue
+		}
+		list := make([]User, 0, len(lists[i]))
+		for _, userID := range lists[i] {
+			if user, ok := users[userID]; ok {
+				list = append(list, user)
+			}
+		}
+		attendees[id] = list
+	}
+	return attendees, errs
+}
+
+func (a *Aggregator) attendeeIDs(ctx context.Context, eventID int64) ([]string, error) {
+	if ids, ok := a.attendees.get(eventID); ok {
+		return ids, nil
+	}
+	resp, err := a.events.GetAllUsersByEvent(ctx, &eventpb.GetAllUsersByEventRequest{EventId: eventID})
+	if err != nil {
+		return nil, err
+	}
+	a.attendees.set(eventID, resp.UsersId)
+	return resp.UsersId, nil
+}
+
+// resolve fetches the users into dst, reporting failures under prefix.
+func (a *Aggregator) resolve(ctx context.Context, result *Result, dst map[string]User, prefix string, ids []string) {
+	users, errs := a.lookup(ctx, ids)
+	for id, err := range errs {
+		result.fail(prefix+"."+id, err)
+	}
+	result.mu.Lock()
+	maps.Copy(dst, users)
+	result.mu.Unlock()
+}
+
+// Lookup returns the users with the given IDs and the errors of the ones
+// that could not be fetched.
+func (a *Aggregator) Lookup(ctx context.Context, ids []string) (map[string]User, map[string]error) {
+	ctx, cancel := a.budget(ctx)
+	defer cancel()
+
+	return a.lookup(ctx, ids)
+}
+
+func (a *Aggregator) lookup(ctx context.Context, ids []string) (map[string]User, map[string]error) {
+	ids = slices.Compact(slices.Sorted(slices.Values(ids)))
+	users := make(map[string]User, len(ids))
+	errs := make(map[string]error)
+	var mu sync.Mutex
+	a.each(len(ids), func(i int) {
+		user, err := a.user(ctx, ids[i])
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			errs[ids[i]] = err
+			return
+		}
+		users[ids[i]] = user
+	})
+	return users, errs
+}
+
+func (a *Aggregator) user(ctx context.Context, id string) (User, error) {
+	if user, ok := a.users.get(id); ok {
+		return user, nil
+	}
+	resp, err := a.auth.IsAdmin(ctx, &authpb.IsAdminRequest{UserUuid: id})
+	if err != nil {
+		return User{}, err
+	}
+	user := User{ID: id, IsAdmin: resp.IsAdmin}
+	a.users.set(id, user)
+	return user, nil
+}
+
+// each calls fn for 0..n-1 with at most config.Workers calls at a time.
+func (a *Aggregator) each(n int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(max(a.config.Workers, 1), n) {
+		wg.Go(func() {
+			for i := range jobs {
+				fn(i)
+			}
+		})
+	}
+	for i := range n {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// budget limits the expansion to config.Timeout and to what is left of the
+// request deadline minus config.Reserve, kept for rendering the response.
+func (a *Aggregator) budget(ctx context.Context) (context.Context, context.CancelFunc) {
+	deadline := time.Now().Add(a.config.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Add(-a.config.Reserve).Before(deadline) {
+		deadline = d.Add(-a.config.Reserve)
+	}
+	return context.WithDeadline(ctx, deadline)
+}
+
+// Status maps an error of a join to an HTTP status and message.
+func Status(err error) (int, string) {
+	if errors.Is(err, context.DeadlineExceeded) || status.Code(err) == codes.DeadlineExceeded {
+		return http.StatusGatewayTimeout, ErrBudgetExhausted.Error()
+	}
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.NotFound:
+		return http.StatusNotFound, st.Message()
+	case codes.PermissionDenied:
+		return http.StatusForbidden, st.Message()
+	case codes.InvalidArgument:
+		return http.StatusBadRequest, st.Message()
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable, "Service unavailable"
+	}
+	return http.StatusInternalServerError, "Internal error"
+}
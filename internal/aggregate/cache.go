@@ -0,0 +1,83 @@
+package aggregate
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type cacheItem[K comparable, V any] struct {
+	key       K
+	value     V
+	expiresAt time.Time
+}
+
+// lru caches joined entities for ttl, bounded by the number of entries.
+type lru[K comparable, V any] struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	order      *list.List
+	items      map[K]*list.Element
+}
+
+func newLRU[K comparable, V any](maxEntries int, ttl time.Duration) *lru[K, V] {
+	return &lru[K, V]{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[K]*list.Element),
+	}
+}
+
+func (l *lru[K, V]) get(key K) (V, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var zero V
+	el, ok := l.items[key]
+	if !ok {
+		return zero, false
+	}
+	item := el.Value.(*cacheItem[K, V])
+	if time.Now().After(item.expiresAt) {
+		l.order.Remove(el)
+		delete(l.items, key)
+		return zero, false
+	}
+	l.order.MoveToFront(el)
+	return item.value, true
+}
+
+func (l *lru[K, V]) set(key K, value V) {
+	if l.ttl <= 0 || l.maxEntries <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	expiresAt := time.Now().Add(l.ttl)
+	if el, ok := l.items[key]; ok {
+		item := el.Value.(*cacheItem[K, V])
+		item.value, item.expiresAt = value, expiresAt
+		l.order.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.order.PushFront(&cacheItem[K, V]{key: key, value: value, expiresAt: expiresAt})
+	for l.order.Len() > l.maxEntries {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(*cacheItem[K, V]).key)
+	}
+}
+
+func (l *lru[K, V]) delete(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.items[key]; ok {
+		l.order.Remove(el)
+		delete(l.items, key)
+	}
+}
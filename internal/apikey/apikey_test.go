@@ -0,0 +1,145 @@
+package apikey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifierVerify(t *testing.T) {
+	store := NewMemoryStore()
+	issue := func(expiresAt time.Time) (*Key, string) {
+		k := New("partner", "user-1", []string{"events:read"}, "standard", expiresAt)
+		raw := k.Rotate()
+		if err := store.Save(k); err != nil {
+			t.Fatal(err)
+		}
+		return k, raw
+	}
+
+	valid, raw := issue(time.Time{})
+	_, future := issue(time.Now().Add(time.Hour))
+	_, expired := issue(time.Now().Add(-time.Hour))
+	rotated, old := issue(time.Time{})
+	rotated.Rotate()
+	if err := store.Save(rotated); err != nil {
+		t.Fatal(err)
+	}
+	id, secret, _ := strings.Cut(raw, ".")
+
+	tests := []struct {
+		name string
+		raw  string
+		id   string
+		err  error
+	}{
+		{"valid", raw, valid.ID, nil},
+		{"expires later", future, strings.Split(future, ".")[0], nil},
+		{"expired", expired, "", ErrExpired},
+		{"rotated away", old, "", ErrInvalid},
+		{"wrong secret", id + ".x" + secret, "", ErrInvalid},
+		{"unknown id", "key_unknown." + secret, "", ErrInvalid},
+		{"no separator", id + secret, "", ErrInvalid},
+		{"empty", "", "", ErrInvalid},
+	}
+	v := NewVerifier(store, time.Minute)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := v.Verify(tt.raw)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if tt.err == nil && k.ID != tt.id {
+				t.Errorf("Verify() key = %q, want %q", k.ID, tt.id)
+			}
+		})
+	}
+}
+
+// countingStore counts the calls of Touch.
+type countingStore struct {
+	*MemoryStore
+	touches int
+}
+
+func (s *countingStore) Touch(uses map[string]time.Time) error {
+	s.touches++
+	return s.MemoryStore.Touch(uses)
+}
+
+func TestVerifierTouch(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		// touches is the number of Touch calls before and after Close.
+		before, after int
+	}{
+		{"batched", time.Hour, 0, 1},
+		{"no interval", 0, 2, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &countingStore{MemoryStore: NewMemoryStore()}
+			var raws []string
+			var ids []string
+			for range 2 {
+				k := New("partner", "user-1", nil, "standard", time.Time{})
+				raws = append(raws, k.Rotate())
+				ids = append(ids, k.ID)
+				if err := store.Save(k); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			start := time.Now().UTC()
+			v := NewVerifier(store, tt.interval)
+			for _, raw := range raws {
+				if _, err := v.Verify(raw); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if store.touches != tt.before {
+				t.Errorf("Touch calls before Close = %d, want %d", store.touches, tt.before)
+			}
+			if err := v.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if store.touches != tt.after {
+				t.Errorf("Touch calls after Close = %d, want %d", store.touches, tt.after)
+			}
+			for _, id := range ids {
+				stored, err := store.Key(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.LastUsed.Before(start) {
+					t.Errorf("last_used of %s = %v, want at least %v", id, stored.LastUsed, start)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyAllows(t *testing.T) {
+	k := &Key{Scopes: []string{"events:write", "webhooks:read"}}
+
+	tests := []struct {
+		scope string
+		want  bool
+	}{
+		{"events:write", true},
+		{"events:read", true},
+		{"webhooks:read", true},
+		{"webhooks:write", false},
+		{"graphql:read", false},
+		{ScopeAdmin, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			if got := k.Allows(tt.scope); got != tt.want {
+				t.Errorf("Allows(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
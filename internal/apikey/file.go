@@ -0,0 +1,100 @@
+package apikey
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileStore keeps keys in memory and writes them to a JSON file after every
+// change. It is meant for local use by a single gateway.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore loads the keys from path, which is created on the first
+// change if it doesn't exist.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var keys []*Key
+	if err := json.Unmarshal(b, &keys); err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		s.keys[k.ID] = k
+	}
+	return s, nil
+}
+
+func (s *FileStore) Save(k *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[k.ID] = copyKey(k)
+	return s.flush()
+}
+
+func (s *FileStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	return s.flush()
+}
+
+// Touch writes the file once for all uses.
+func (s *FileStore) Touch(uses map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.touch(uses)
+	return s.flush()
+}
+
+// flush replaces the file, so that a crash never leaves it half-written.
+// s.mu must be held.
+func (s *FileStore) flush() error {
+	keys := make([]*Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		keys = append(keys, k)
+	}
+	b, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
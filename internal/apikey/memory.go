@@ -0,0 +1,86 @@
+package apikey
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps keys in process memory; they are lost on restart.
+type MemoryStore struct {
+	mu   sync.Mutex
+	keys map[string]*Key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		keys: make(map[string]*Key),
+	}
+}
+
+func (s *MemoryStore) Save(k *Key) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[k.ID] = copyKey(k)
+	return nil
+}
+
+func (s *MemoryStore) Key(id string) (*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyKey(k), nil
+}
+
+func (s *MemoryStore) Keys() ([]*Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*Key, 0, len(s.keys))
+	for _, k := range s.keys {
+		result = append(result, copyKey(k))
+	}
+	slices.SortFunc(result, func(a, b *Key) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return result, nil
+}
+
+func (s *MemoryStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.keys[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.keys, id)
+	return nil
+}
+
+func (s *MemoryStore) Touch(uses map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.touch(uses)
+	return nil
+}
+
+// touch sets the last uses of the existing keys. s.mu must be held.
+func (s *MemoryStore) touch(uses map[string]time.Time) {
+	for id, at := range uses {
+		if k, ok := s.keys[id]; ok {
+			k.LastUsed = at
+		}
+	}
+}
+
+func copyKey(k *Key) *Key {
+	c := *k
+	c.Scopes = slices.Clone(k.Scopes)
+	return &c
+}
@@ -0,0 +1,113 @@
+package apikey
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalid = errors.New("API key is not valid")
+	ErrExpired = errors.New("API key has expired")
+)
+
+// Verifier checks API keys against the store and records their last use.
+type Verifier struct {
+	store Store
+	// touchInterval is how often the last uses of keys are written to the
+	// store, all at once; with 0 they are written on every use.
+	touchInterval time.Duration
+
+	mu        sync.Mutex
+	pending   map[string]time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewVerifier(store Store, touchInterval time.Duration) *Verifier {
+	v := &Verifier{
+		store:         store,
+		touchInterval: touchInterval,
+		pending:       make(map[string]time.Time),
+		done:          make(chan struct{}),
+	}
+	if touchInterval > 0 {
+		v.wg.Add(1)
+		go v.run()
+	}
+	return v
+}
+
+// Verify returns the key of raw. It returns ErrInvalid for unknown keys and
+// wrong secrets and ErrExpired for expired keys.
+func (v *Verifier) Verify(raw string) (*Key, error) {
+	id, secret, ok := strings.Cut(raw, ".")
+	if !ok {
+		return nil, ErrInvalid
+	}
+
+	k, err := v.store.Key(id)
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(hash(secret))) != 1 {
+		return nil, ErrInvalid
+	}
+
+	now := time.Now().UTC()
+	if k.expired(now) {
+		return nil, ErrExpired
+	}
+	// last_used is informational, so failing to record it doesn't fail the
+	// request.
+	if v.touchInterval > 0 {
+		v.mu.Lock()
+		v.pending[id] = now
+		v.mu.Unlock()
+	} else {
+		v.store.Touch(map[string]time.Time{id: now})
+	}
+	k.LastUsed = now
+	return k, nil
+}
+
+// Flush writes the last uses recorded since the previous flush.
+func (v *Verifier) Flush() error {
+	v.mu.Lock()
+	uses := v.pending
+	v.pending = make(map[string]time.Time)
+	v.mu.Unlock()
+
+	if len(uses) == 0 {
+		return nil
+	}
+	return v.store.Touch(uses)
+}
+
+// Close stops the periodic flushes and writes the pending last uses.
+func (v *Verifier) Close() error {
+	v.closeOnce.Do(func() { close(v.done) })
+	v.wg.Wait()
+	return v.Flush()
+}
+
+func (v *Verifier) run() {
+	defer v.wg.Done()
+
+	ticker := time.NewTicker(v.touchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			v.Flush()
+		case <-v.done:
+			return
+		}
+	}
+}
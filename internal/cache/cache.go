@@ -0,0 +1,28 @@
+package cache
+
+import (
+	"net/http"
+	"time"
+)
+
+// Entry is a cached HTTP response.
+type Entry struct {
+	Status    int
+	Header    http.Header
+	Body      []byte
+	ExpiresAt time.Time
+}
+
+func (e *Entry) Expired(now time.Time) bool {
+	return now.After(e.ExpiresAt)
+}
+
+// Backend stores cached responses. The in-memory LRU is used by default; a
+// shared backend (e.g. Redis) can be plugged in to share the cache between
+// gateway instances.
+type Backend interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	// DeletePrefix removes every entry whose key starts with prefix.
+	DeletePrefix(prefix string)
+}
@@ -0,0 +1,73 @@
+package cache
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLRUDeletePrefix(t *testing.T) {
+	keys := []string{
+		"events:/v1/events/1?|format=json",
+		"events:/v1/events/?limit=5|format=json",
+		"events:/events/1?|format=msgpack",
+		"eventsx:/v1/eventsx/1?|format=json",
+		"users:/v1/users/1?|format=json",
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		kept   []string
+	}{
+		{"namespace", "events:", keys[3:]},
+		{"path", "events:/v1/events/1", keys[1:]},
+		{"no match", "webhooks:", keys},
+		{"everything", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLRU(0)
+			for _, key := range keys {
+				l.Set(key, &Entry{ExpiresAt: time.Now().Add(time.Minute)})
+			}
+
+			l.DeletePrefix(tt.prefix)
+
+			for _, key := range keys {
+				_, ok := l.Get(key)
+				if want := slices.Contains(tt.kept, key); ok != want {
+					t.Errorf("Get(%q) found = %v, want %v", key, ok, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUGet(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxEntries int
+		ttl        time.Duration
+		keys       []string
+		get        string
+		found      bool
+	}{
+		{"fresh", 0, time.Minute, []string{"a"}, "a", true},
+		{"expired", 0, -time.Second, []string{"a"}, "a", false},
+		{"missing", 0, time.Minute, []string{"a"}, "b", false},
+		{"evicted", 2, time.Minute, []string{"a", "b", "c"}, "a", false},
+		{"within bound", 2, time.Minute, []string{"a", "b", "c"}, "b", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLRU(tt.maxEntries)
+			for _, key := range tt.keys {
+				l.Set(key, &Entry{ExpiresAt: time.Now().Add(tt.ttl)})
+			}
+			if _, ok := l.Get(tt.get); ok != tt.found {
+				t.Errorf("Get(%q) found = %v, want %v", tt.get, ok, tt.found)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+)
+
+// Metrics counts, per gRPC method, the requests that went through the
+// coalescer ("<method>.requests") and the ones served by another in-flight
+// call ("<method>.coalesced"). It is published at /debug/vars.
+var Metrics = expvar.NewMap("coalescing")
+
+var errNotProto = errors.New("request is not a protobuf message")
+
+type result struct {
+	reply  proto.Message
+	header metadata.MD
+}
+
+// Coalescer collapses identical concurrent unary calls to the configured
+// methods into one upstream call and fans the result out to every caller.
+type Coalescer struct {
+	group   singleflight.Group
+	methods map[string]bool
+	timeout time.Duration
+}
+
+// New returns a coalescer for the given full method names
+// (e.g. /event.Event/GetById). The shared call is detached from the caller
+// that started it and is bounded by timeout instead.
+func New(methods []string, timeout time.Duration) *Coalescer {
+	set := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		set[m] = true
+	}
+	return &Coalescer{
+		methods: set,
+		timeout: timeout,
+	}
+}
+
+func (cl *Coalescer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if !cl.methods[method] {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		key, err := requestKey(ctx, method, req)
+		if err != nil {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		out, ok := reply.(proto.Message)
+		if !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		Metrics.Add(method+".requests", 1)
+
+		executed := false
+		ch := cl.group.DoChan(key, func() (any, error) {
+			executed = true
+			callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cl.timeout)
+			defer cancel()
+
+			r := &result{reply: out.ProtoReflect().New().Interface()}
+			err := invoker(callCtx, method, req, r.reply, cc, append(opts, grpc.Header(&r.header))...)
+			return r, err
+		})
+
+		var res singleflight.Result
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case res = <-ch:
+		}
+		if !executed {
+			Metrics.Add(method+".coalesced", 1)
+		}
+		if res.Err != nil {
+			return res.Err
+		}
+
+		r := res.Val.(*result)
+		proto.Merge(out, r.reply)
+		for _, opt := range opts {
+			if h, ok := opt.(grpc.HeaderCallOption); ok {
+				*h.HeaderAddr = r.header.Copy()
+			}
+		}
+		return nil
+	}
+}
+
+// requestKey identifies a call by method, deterministic request encoding and
+// outgoing metadata, which carries request-scoped parameters.
+func requestKey(ctx context.Context, method string, req any) (string, error) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return "", errNotProto
+	}
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+
+	var key strings.Builder
+	key.WriteString(method)
+	key.WriteByte(0)
+	key.Write(b)
+
+	md, _ := metadata.FromOutgoingContext(ctx)
+	names := make([]string, 0, len(md))
+	for name := range md {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		key.WriteByte(0)
+		key.WriteString(name)
+		key.WriteByte('=')
+		key.WriteString(strings.Join(md[name], ","))
+	}
+	return key.String(), nil
+}
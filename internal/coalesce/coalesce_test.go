@@ -0,0 +1,165 @@
+package coalesce
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const testMethod = "/event.Event/GetById"
+
+// blockingInvoker answers every call with the request value doubled once
+// release is closed.
+type blockingInvoker struct {
+	calls   atomic.Int32
+	release chan struct{}
+	err     error
+}
+
+func (b *blockingInvoker) invoke(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	b.calls.Add(1)
+	<-b.release
+	if b.err != nil {
+		return b.err
+	}
+	reply.(*wrapperspb.Int64Value).Value = req.(*wrapperspb.Int64Value).Value * 2
+	for _, opt := range opts {
+		if h, ok := opt.(grpc.HeaderCallOption); ok {
+			*h.HeaderAddr = metadata.Pairs("x-served-by", "upstream")
+		}
+	}
+	return nil
+}
+
+// callConcurrently starts one call per request and releases the invoker once
+// they all had time to join the in-flight call.
+func callConcurrently(t *testing.T, interceptor grpc.UnaryClientInterceptor, inv *blockingInvoker, ctxs []context.Context, reqs []int64) ([]*wrapperspb.Int64Value, []metadata.MD, []error) {
+	t.Helper()
+	replies := make([]*wrapperspb.Int64Value, len(reqs))
+	headers := make([]metadata.MD, len(reqs))
+	errs := make([]error, len(reqs))
+
+	var wg sync.WaitGroup
+	for i, v := range reqs {
+		replies[i] = &wrapperspb.Int64Value{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = interceptor(ctxs[i], testMethod, wrapperspb.Int64(v), replies[i], nil, inv.invoke, grpc.Header(&headers[i]))
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(inv.release)
+	wg.Wait()
+	return replies, headers, errs
+}
+
+func background(n int) []context.Context {
+	ctxs := make([]context.Context, n)
+	for i := range ctxs {
+		ctxs[i] = context.Background()
+	}
+	return ctxs
+}
+
+func TestCoalescerSharesIdenticalCalls(t *testing.T) {
+	inv := &blockingInvoker{release: make(chan struct{})}
+	interceptor := New([]string{testMethod}, time.Second).UnaryClientInterceptor()
+
+	replies, headers, errs := callConcurrently(t, interceptor, inv, background(5), []int64{21, 21, 21, 21, 4})
+
+	if got := inv.calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want 2", got)
+	}
+	for i, want := range []int64{42, 42, 42, 42, 8} {
+		if errs[i] != nil {
+			t.Fatalf("call %d: %v", i, errs[i])
+		}
+		if replies[i].Value != want {
+			t.Errorf("call %d reply = %d, want %d", i, replies[i].Value, want)
+		}
+		if got := headers[i].Get("x-served-by"); len(got) != 1 {
+			t.Errorf("call %d header = %v, want the upstream header", i, headers[i])
+		}
+	}
+	// Callers own their reply, so changing one doesn't affect the others.
+	replies[0].Value = 0
+	if replies[1].Value != 42 {
+		t.Error("replies share memory")
+	}
+}
+
+func TestCoalescerKeepsMetadataApart(t *testing.T) {
+	inv := &blockingInvoker{release: make(chan struct{})}
+	interceptor := New([]string{testMethod}, time.Second).UnaryClientInterceptor()
+
+	ctxs := []context.Context{
+		metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer a"),
+		metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer b"),
+	}
+	callConcurrently(t, interceptor, inv, ctxs, []int64{1, 1})
+
+	if got := inv.calls.Load(); got != 2 {
+		t.Errorf("upstream calls = %d, want one per caller", got)
+	}
+}
+
+func TestCoalescerSharesErrors(t *testing.T) {
+	errUpstream := errors.New("unavailable")
+	inv := &blockingInvoker{release: make(chan struct{}), err: errUpstream}
+	interceptor := New([]string{testMethod}, time.Second).UnaryClientInterceptor()
+
+	_, _, errs := callConcurrently(t, interceptor, inv, background(3), []int64{1, 1, 1})
+
+	if got := inv.calls.Load(); got != 1 {
+		t.Errorf("upstream calls = %d, want 1", got)
+	}
+	for i, err := range errs {
+		if !errors.Is(err, errUpstream) {
+			t.Errorf("call %d error = %v, want %v", i, err, errUpstream)
+		}
+	}
+}
+
+func TestCoalescerCallerCancel(t *testing.T) {
+	inv := &blockingInvoker{release: make(chan struct{})}
+	interceptor := New([]string{testMethod}, time.Second).UnaryClientInterceptor()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	ctxs := []context.Context{canceled, context.Background()}
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	replies, _, errs := callConcurrently(t, interceptor, inv, ctxs, []int64{3, 3})
+
+	if !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("canceled caller error = %v, want %v", errs[0], context.Canceled)
+	}
+	// The shared call is detached from the caller that started it.
+	if errs[1] != nil || replies[1].Value != 6 {
+		t.Errorf("other caller = %v, %v, want 6", replies[1], errs[1])
+	}
+}
+
+func TestCoalescerOtherMethods(t *testing.T) {
+	inv := &blockingInvoker{release: make(chan struct{})}
+	close(inv.release)
+	interceptor := New([]string{testMethod}, time.Second).UnaryClientInterceptor()
+
+	reply := &wrapperspb.Int64Value{}
+	if err := interceptor(context.Background(), "/event.Event/Create", wrapperspb.Int64(1), reply, nil, inv.invoke); err != nil {
+		t.Fatal(err)
+	}
+	if !proto.Equal(reply, wrapperspb.Int64(2)) || inv.calls.Load() != 1 {
+		t.Errorf("reply = %v after %d calls, want a direct call", reply, inv.calls.Load())
+	}
+}
@@ -0,0 +1,171 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrEmptyBody = errors.New("request body is empty")
+
+var messageType = reflect.TypeOf((*proto.Message)(nil)).Elem()
+
+// Codec binds request bodies into protobuf messages and renders responses that
+// contain them. JSON and MessagePack go through protojson, so every endpoint
+// follows the same field naming, int64, timestamp and enum conventions.
+type Codec struct {
+	marshal   protojson.MarshalOptions
+	unmarshal protojson.UnmarshalOptions
+}
+
+func New(config config.Protojson) *Codec {
+	return &Codec{
+		marshal: protojson.MarshalOptions{
+			UseProtoNames:   config.UseProtoNames,
+			EmitUnpopulated: config.EmitUnpopulated,
+			UseEnumNumbers:  config.UseEnumNumbers,
+		},
+		unmarshal: protojson.UnmarshalOptions{
+			DiscardUnknown: config.DiscardUnknown,
+		},
+	}
+}
+
+func (cd *Codec) Bind(c *gin.Context, m proto.Message) error {
+	if c.Request.Body == nil {
+		return ErrEmptyBody
+	}
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 {
+		return ErrEmptyBody
+	}
+
+	switch c.ContentType() {
+	case MIMEProtobuf, MIMEProtobuf2:
+		return proto.Unmarshal(body, m)
+	case MIMEMsgpack, MIMEMsgpack2:
+		if body, err = MsgpackToJSON(body); err != nil {
+			return err
+		}
+	}
+	return cd.Unmarshal(body, m)
+}
+
+func (cd *Codec) Unmarshal(b []byte, m proto.Message) error {
+	return cd.unmarshal.Unmarshal(b, m)
+}
+
+// Document marshals m with every field present, so that JSON Patch operations
+// can address any of them.
+func (cd *Codec) Document(m proto.Message) ([]byte, error) {
+	options := cd.marshal
+	options.EmitUnpopulated = true
+	return options.Marshal(m)
+}
+
+// Render writes obj in the format negotiated from the Accept header. JSON and
+// MessagePack encode every protobuf message found in obj (directly, in maps or
+// in slices) with protojson; protobuf responses carry obj as a
+// google.protobuf.Struct.
+func (cd *Codec) Render(c *gin.Context, code int, obj any) {
+	cd.RenderMessage(c, code, obj, nil)
+}
+
+// RenderMessage is like Render, but protobuf responses carry the raw payload
+// message instead of obj.
+func (cd *Codec) RenderMessage(c *gin.Context, code int, obj any, payload proto.Message) {
+	c.Writer.Header().Add("Vary", "Accept")
+
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+	switch Negotiate(c.GetHeader("Accept")) {
+	case FormatProtobuf:
+		body, contentType, err = cd.marshalProtobuf(obj, payload)
+	case FormatMsgpack:
+		body, err = cd.marshalMsgpack(obj)
+		contentType = MIMEMsgpack
+	default:
+		body, err = cd.Marshal(obj)
+		contentType = gin.MIMEJSON + "; charset=utf-8"
+	}
+	if err != nil {
+		c.JSON(
+			http.StatusInternalServerError,
+			gin.H{
+				"code":    http.StatusInternalServerError,
+				"message": "Internal error",
+			},
+		)
+		return
+	}
+	c.Data(code, contentType, body)
+}
+
+func (cd *Codec) Marshal(obj any) ([]byte, error) {
+	value, err := cd.convert(obj)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func (cd *Codec) convert(obj any) (any, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	if m, ok := obj.(proto.Message); ok {
+		if reflect.ValueOf(m).IsNil() {
+			return nil, nil
+		}
+		b, err := cd.marshal.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		return json.RawMessage(b), nil
+	}
+
+	rv := reflect.ValueOf(obj)
+	switch rv.Kind() {
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return obj, nil
+		}
+		result := make(map[string]any, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			v, err := cd.convert(iter.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			result[iter.Key().String()] = v
+		}
+		return result, nil
+	case reflect.Slice:
+		if !rv.Type().Elem().Implements(messageType) {
+			return obj, nil
+		}
+		result := make([]any, rv.Len())
+		for i := range rv.Len() {
+			v, err := cd.convert(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			result[i] = v
+		}
+		return result, nil
+	}
+	return obj, nil
+}
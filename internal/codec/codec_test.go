@@ -0,0 +1,138 @@
+package codec
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func TestMarshalNestedMessages(t *testing.T) {
+	cd := New(config.Protojson{UseProtoNames: true})
+	event := &pb.EventElem{
+		Id:           9007199254740993,
+		Title:        "Go meetup",
+		StartDate:    &timestamppb.Timestamp{Seconds: 1735689600},
+		MaxAttendees: 10,
+	}
+
+	b, err := cd.Marshal(gin.H{
+		"code":   http.StatusOK,
+		"event":  event,
+		"events": []*pb.EventElem{event},
+		"empty":  (*pb.EventElem)(nil),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	rendered, ok := got["event"].(map[string]any)
+	if !ok {
+		t.Fatalf("event = %#v, want an object", got["event"])
+	}
+	// int64 is a string in protojson, so JavaScript clients don't round it.
+	if rendered["id"] != "9007199254740993" {
+		t.Errorf("id = %#v, want the string \"9007199254740993\"", rendered["id"])
+	}
+	if rendered["start_date"] != "2025-01-01T00:00:00Z" {
+		t.Errorf("start_date = %#v, want an RFC 3339 timestamp", rendered["start_date"])
+	}
+	if _, ok := rendered["max_attendees"]; !ok {
+		t.Errorf("event has no max_attendees field with UseProtoNames: %v", rendered)
+	}
+	if events, ok := got["events"].([]any); !ok || len(events) != 1 {
+		t.Errorf("events = %#v, want one rendered event", got["events"])
+	}
+	if got["empty"] != nil {
+		t.Errorf("nil message rendered as %#v, want null", got["empty"])
+	}
+	if got["code"] != float64(http.StatusOK) {
+		t.Errorf("code = %#v, want %d", got["code"], http.StatusOK)
+	}
+}
+
+func TestMarshalOptions(t *testing.T) {
+	event := &pb.EventElem{MaxAttendees: 10}
+
+	tests := []struct {
+		name    string
+		config  config.Protojson
+		present []string
+		absent  []string
+	}{
+		{"json names", config.Protojson{}, []string{`"maxAttendees"`}, []string{`"max_attendees"`, `"title"`}},
+		{"proto names", config.Protojson{UseProtoNames: true}, []string{`"max_attendees"`}, []string{`"maxAttendees"`}},
+		{"emit unpopulated", config.Protojson{EmitUnpopulated: true}, []string{`"title"`, `"creator"`}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := New(tt.config).Marshal(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, field := range tt.present {
+				if !strings.Contains(string(b), field) {
+					t.Errorf("%s has no %s", b, field)
+				}
+			}
+			for _, field := range tt.absent {
+				if strings.Contains(string(b), field) {
+					t.Errorf("%s has %s", b, field)
+				}
+			}
+		})
+	}
+}
+
+func TestBind(t *testing.T) {
+	tests := []struct {
+		name    string
+		discard bool
+		body    string
+		title   string
+		wantErr bool
+		err     error
+	}{
+		{"proto names", false, `{"title":"Go","max_attendees":5}`, "Go", false, nil},
+		{"json names", false, `{"title":"Go","maxAttendees":5}`, "Go", false, nil},
+		{"unknown field rejected", false, `{"title":"Go","venue":"x"}`, "", true, nil},
+		{"unknown field discarded", true, `{"title":"Go","venue":"x"}`, "Go", false, nil},
+		{"wrong type", false, `{"max_attendees":"many"}`, "", true, nil},
+		{"empty body", false, ``, "", true, ErrEmptyBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/events/", strings.NewReader(tt.body))
+
+			var req pb.CreateRequest
+			err := New(config.Protojson{DiscardUnknown: tt.discard}).Bind(c, &req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Bind() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("Bind() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && req.Title != tt.title {
+				t.Errorf("Title = %q, want %q", req.Title, tt.title)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	ugorji "github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	MIMEProtobuf  = "application/x-protobuf"
+	MIMEProtobuf2 = "application/protobuf"
+	MIMEMsgpack   = "application/msgpack"
+	MIMEMsgpack2  = "application/x-msgpack"
+)
+
+const (
+	FormatJSON     = "json"
+	FormatProtobuf = "protobuf"
+	FormatMsgpack  = "msgpack"
+)
+
+var formats = map[string]string{
+	gin.MIMEJSON:  FormatJSON,
+	MIMEProtobuf:  FormatProtobuf,
+	MIMEProtobuf2: FormatProtobuf,
+	MIMEMsgpack:   FormatMsgpack,
+	MIMEMsgpack2:  FormatMsgpack,
+}
+
+var msgpackHandle = func() *ugorji.MsgpackHandle {
+	h := &ugorji.MsgpackHandle{}
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	h.RawToString = true
+	h.WriteExt = true
+	return h
+}()
+
+// Negotiate returns the response format with the highest q-value in the
+// Accept header. JSON is used when the header is empty or lists nothing
+// supported.
+func Negotiate(accept string) string {
+	if accept == "" {
+		return FormatJSON
+	}
+
+	best, bestQ := FormatJSON, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		format, ok := formats[mediaType]
+		if !ok {
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = format, q
+		}
+	}
+	return best
+}
+
+// MsgpackToJSON transcodes a MessagePack document to JSON.
+func MsgpackToJSON(b []byte) ([]byte, error) {
+	var v any
+	if err := ugorji.NewDecoderBytes(b, msgpackHandle).Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func (cd *Codec) marshalProtobuf(obj any, payload proto.Message) ([]byte, string, error) {
+	if payload == nil {
+		b, err := cd.Marshal(obj)
+		if err != nil {
+			return nil, "", err
+		}
+		envelope := &structpb.Struct{}
+		if err := envelope.UnmarshalJSON(b); err != nil {
+			return nil, "", err
+		}
+		payload = envelope
+	}
+
+	body, err := proto.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	contentType := MIMEProtobuf + `; messageType="` + string(payload.ProtoReflect().Descriptor().FullName()) + `"`
+	return body, contentType, nil
+}
+
+func (cd *Codec) marshalMsgpack(obj any) ([]byte, error) {
+	b, err := cd.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var v any
+	if err := decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	var out []byte
+	if err := ugorji.NewEncoderBytes(&out, msgpackHandle).Encode(numbers(v)); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// numbers replaces json.Number values with int64 or float64, so that they are
+// encoded as MessagePack numbers rather than strings.
+func numbers(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, item := range t {
+			t[k] = numbers(item)
+		}
+	case []any:
+		for i, item := range t {
+			t[i] = numbers(item)
+		}
+	case json.Number:
+		if n, err := t.Int64(); err == nil {
+			return n
+		}
+		if f, err := t.Float64(); err == nil {
+			return f
+		}
+	}
+	return v
+}
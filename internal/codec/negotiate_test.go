@@ -0,0 +1,153 @@
+package codec
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	ugorji "github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", FormatJSON},
+		{"*/*", FormatJSON},
+		{"text/html", FormatJSON},
+		{"application/json", FormatJSON},
+		{"application/x-protobuf", FormatProtobuf},
+		{"application/protobuf", FormatProtobuf},
+		{"application/msgpack", FormatMsgpack},
+		{"Application/X-MsgPack", FormatMsgpack},
+		{"application/json;q=0.5, application/msgpack", FormatMsgpack},
+		{"application/json, application/msgpack;q=0.9", FormatJSON},
+		{"application/x-protobuf; charset=x; q=0.1, application/json;q=0.2", FormatJSON},
+		{"application/msgpack;q=0", FormatJSON},
+	}
+	for _, tt := range tests {
+		if got := Negotiate(tt.accept); got != tt.want {
+			t.Errorf("Negotiate(%q) = %q, want %q", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestRenderMessage(t *testing.T) {
+	cd := New(config.Protojson{UseProtoNames: true})
+	event := &pb.EventElem{Id: 7, Title: "Go meetup", MaxAttendees: 30}
+	obj := gin.H{"code": http.StatusOK, "event": event}
+
+	render := func(accept string, payload proto.Message) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/events/7", nil)
+		c.Request.Header.Set("Accept", accept)
+		cd.RenderMessage(c, http.StatusOK, obj, payload)
+		return w
+	}
+
+	t.Run("json", func(t *testing.T) {
+		w := render("", event)
+		if got := w.Header().Get("Content-Type"); got != "application/json; charset=utf-8" {
+			t.Errorf("Content-Type = %q", got)
+		}
+		if !strings.Contains(w.Body.String(), `"max_attendees":30`) {
+			t.Errorf("body = %s", w.Body)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept" {
+			t.Errorf("Vary = %q, want Accept", got)
+		}
+	})
+
+	t.Run("protobuf payload", func(t *testing.T) {
+		w := render(MIMEProtobuf, event)
+		if got, want := w.Header().Get("Content-Type"), MIMEProtobuf+`; messageType="event.EventElem"`; got != want {
+			t.Errorf("Content-Type = %q, want %q", got, want)
+		}
+		var got pb.EventElem
+		if err := proto.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !proto.Equal(&got, event) {
+			t.Errorf("decoded %v, want %v", &got, event)
+		}
+	})
+
+	t.Run("protobuf envelope", func(t *testing.T) {
+		w := render(MIMEProtobuf, nil)
+		if got, want := w.Header().Get("Content-Type"), MIMEProtobuf+`; messageType="google.protobuf.Struct"`; got != want {
+			t.Errorf("Content-Type = %q, want %q", got, want)
+		}
+		var got structpb.Struct
+		if err := proto.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if title := got.Fields["event"].GetStructValue().Fields["title"].GetStringValue(); title != "Go meetup" {
+			t.Errorf("event.title = %q, want %q", title, "Go meetup")
+		}
+	})
+
+	t.Run("msgpack", func(t *testing.T) {
+		w := render(MIMEMsgpack, event)
+		if got := w.Header().Get("Content-Type"); got != MIMEMsgpack {
+			t.Errorf("Content-Type = %q, want %q", got, MIMEMsgpack)
+		}
+		var got map[string]any
+		if err := ugorji.NewDecoderBytes(w.Body.Bytes(), msgpackHandle).Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		rendered := got["event"].(map[string]any)
+		// Numbers are MessagePack integers, except int64 which protojson renders
+		// as a string.
+		if rendered["max_attendees"] != int64(30) || rendered["id"] != "7" || got["code"] != int64(http.StatusOK) {
+			t.Errorf("decoded %#v", got)
+		}
+	})
+}
+
+func TestBindFormats(t *testing.T) {
+	cd := New(config.Protojson{})
+	want := &pb.CreateRequest{Title: "Go", MaxAttendees: 5}
+
+	protobuf, err := proto.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msgpack []byte
+	if err := ugorji.NewEncoderBytes(&msgpack, msgpackHandle).Encode(map[string]any{"title": "Go", "max_attendees": 5}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		contentType string
+		body        []byte
+	}{
+		{gin.MIMEJSON, []byte(`{"title":"Go","maxAttendees":5}`)},
+		{MIMEProtobuf, protobuf},
+		{MIMEProtobuf2, protobuf},
+		{MIMEMsgpack, msgpack},
+		{MIMEMsgpack2 + "; charset=binary", msgpack},
+	}
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/events/", strings.NewReader(string(tt.body)))
+			c.Request.Header.Set("Content-Type", tt.contentType)
+
+			var got pb.CreateRequest
+			if err := cd.Bind(c, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(&got, want) {
+				t.Errorf("Bind() = %v, want %v", &got, want)
+			}
+		})
+	}
+}
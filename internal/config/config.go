@@ -4,6 +4,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/go-viper/mapstructure/v2"
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
@@ -16,6 +17,28 @@ type Config struct {
 	Timeout           time.Duration `mapstructure:"timeout"`
 	Event             Event         `mapstructure:"event"`
 	Auth              Auth          `mapstructure:"auth"`
+	Protojson         Protojson     `mapstructure:"protojson"`
+	Versioning        Versioning    `mapstructure:"versioning"`
+	Pagination        Pagination    `mapstructure:"pagination"`
+	Idempotency       Idempotency   `mapstructure:"idempotency"`
+	Cache             Cache         `mapstructure:"cache"`
+	Coalescing        Coalescing    `mapstructure:"coalescing"`
+	Compression       Compression   `mapstructure:"compression"`
+	Calendar          Calendar      `mapstructure:"calendar"`
+	Export            Export        `mapstructure:"export"`
+	Stream            Stream        `mapstructure:"stream"`
+	WebSocket         WebSocket     `mapstructure:"websocket"`
+	Webhooks          Webhooks      `mapstructure:"webhooks"`
+	Batch             Batch         `mapstructure:"batch"`
+	Bulk              Bulk          `mapstructure:"bulk"`
+	Expand            Expand        `mapstructure:"expand"`
+	GraphQL           GraphQL       `mapstructure:"graphql"`
+	RPC               RPC           `mapstructure:"rpc"`
+	GRPC              GRPC          `mapstructure:"grpc"`
+	Session           Session       `mapstructure:"session"`
+	APIKeys           APIKeys       `mapstructure:"api_keys"`
+	DebugVars         bool          `mapstructure:"debug_vars"`
+	DebugAddr         string        `mapstructure:"debug_addr"`
 }
 
 type Event struct {
@@ -28,6 +51,173 @@ type Auth struct {
 	Host string `mapstructure:"host"`
 }
 
+type Protojson struct {
+	UseProtoNames   bool `mapstructure:"use_proto_names"`
+	EmitUnpopulated bool `mapstructure:"emit_unpopulated"`
+	UseEnumNumbers  bool `mapstructure:"use_enum_numbers"`
+	DiscardUnknown  bool `mapstructure:"discard_unknown"`
+}
+
+type Pagination struct {
+	DefaultLimit int `mapstructure:"default_limit"`
+	MaxLimit     int `mapstructure:"max_limit"`
+}
+
+type Idempotency struct {
+	TTL         time.Duration `mapstructure:"ttl"`
+	WaitTimeout time.Duration `mapstructure:"wait_timeout"`
+}
+
+type Cache struct {
+	Enabled    bool         `mapstructure:"enabled"`
+	MaxEntries int          `mapstructure:"max_entries"`
+	Routes     []CacheRoute `mapstructure:"routes"`
+}
+
+type CacheRoute struct {
+	Path    string        `mapstructure:"path"`
+	TTL     time.Duration `mapstructure:"ttl"`
+	PerUser bool          `mapstructure:"per_user"`
+}
+
+type Coalescing struct {
+	Enabled bool     `mapstructure:"enabled"`
+	Methods []string `mapstructure:"methods"`
+}
+
+type Compression struct {
+	Enabled        bool     `mapstructure:"enabled"`
+	MinSize        int      `mapstructure:"min_size"`
+	Encodings      []string `mapstructure:"encodings"`
+	ContentTypes   []string `mapstructure:"content_types"`
+	MaxRequestSize int64    `mapstructure:"max_request_size"`
+}
+
+type Calendar struct {
+	ProdID     string        `mapstructure:"prod_id"`
+	UIDDomain  string        `mapstructure:"uid_domain"`
+	FeedSecret string        `mapstructure:"feed_secret"`
+	FeedTTL    time.Duration `mapstructure:"feed_ttl"`
+	// RevocationsFile keeps feed token revocations in a JSON file; they are
+	// kept in memory and lost on restart if empty.
+	RevocationsFile string `mapstructure:"revocations_file"`
+}
+
+type Export struct {
+	FlushRows    int      `mapstructure:"flush_rows"`
+	EventColumns []string `mapstructure:"event_columns"`
+	UserColumns  []string `mapstructure:"user_columns"`
+}
+
+type Stream struct {
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Heartbeat    time.Duration `mapstructure:"heartbeat"`
+	Retry        time.Duration `mapstructure:"retry"`
+	History      int           `mapstructure:"history"`
+	Buffer       int           `mapstructure:"buffer"`
+	MaxPerUser   int           `mapstructure:"max_per_user"`
+	MaxTopics    int           `mapstructure:"max_topics"`
+}
+
+type WebSocket struct {
+	Subprotocols     []string      `mapstructure:"subprotocols"`
+	AuthTimeout      time.Duration `mapstructure:"auth_timeout"`
+	PingInterval     time.Duration `mapstructure:"ping_interval"`
+	PongWait         time.Duration `mapstructure:"pong_wait"`
+	WriteWait        time.Duration `mapstructure:"write_wait"`
+	SendQueue        int           `mapstructure:"send_queue"`
+	MaxMessageSize   int64         `mapstructure:"max_message_size"`
+	MaxSubscriptions int           `mapstructure:"max_subscriptions"`
+	MaxPerUser       int           `mapstructure:"max_per_user"`
+}
+
+type Webhooks struct {
+	Workers     int           `mapstructure:"workers"`
+	Queue       int           `mapstructure:"queue"`
+	Timeout     time.Duration `mapstructure:"timeout"`
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Backoff     time.Duration `mapstructure:"backoff"`
+	MaxBackoff  time.Duration `mapstructure:"max_backoff"`
+	LogSize     int           `mapstructure:"log_size"`
+}
+
+type Batch struct {
+	MaxSize     int `mapstructure:"max_size"`
+	Concurrency int `mapstructure:"concurrency"`
+}
+
+type Bulk struct {
+	MaxIDs  int `mapstructure:"max_ids"`
+	Workers int `mapstructure:"workers"`
+}
+
+type Expand struct {
+	Timeout      time.Duration `mapstructure:"timeout"`
+	Reserve      time.Duration `mapstructure:"reserve"`
+	Workers      int           `mapstructure:"workers"`
+	MaxEntries   int           `mapstructure:"max_entries"`
+	UserTTL      time.Duration `mapstructure:"user_ttl"`
+	AttendeesTTL time.Duration `mapstructure:"attendees_ttl"`
+}
+
+type GraphQL struct {
+	MaxDepth        int `mapstructure:"max_depth"`
+	MaxComplexity   int `mapstructure:"max_complexity"`
+	DefaultListSize int `mapstructure:"default_list_size"`
+}
+
+type RPC struct {
+	Enabled        bool   `mapstructure:"enabled"`
+	Prefix         string `mapstructure:"prefix"`
+	MaxMessageSize int    `mapstructure:"max_message_size"`
+}
+
+type GRPC struct {
+	Enabled        bool `mapstructure:"enabled"`
+	Port           int  `mapstructure:"port"`
+	MaxMessageSize int  `mapstructure:"max_message_size"`
+	Reflection     bool `mapstructure:"reflection"`
+}
+
+type Session struct {
+	Enabled        bool          `mapstructure:"enabled"`
+	AccessCookie   string        `mapstructure:"access_cookie"`
+	RefreshCookie  string        `mapstructure:"refresh_cookie"`
+	CSRFCookie     string        `mapstructure:"csrf_cookie"`
+	CSRFHeader     string        `mapstructure:"csrf_header"`
+	AccessTTL      time.Duration `mapstructure:"access_ttl"`
+	RefreshTTL     time.Duration `mapstructure:"refresh_ttl"`
+	RefreshGrace   time.Duration `mapstructure:"refresh_grace"`
+	Domain         string        `mapstructure:"domain"`
+	Secure         bool          `mapstructure:"secure"`
+	SameSite       string        `mapstructure:"same_site"`
+	AllowedOrigins []string      `mapstructure:"allowed_origins"`
+}
+
+type APIKeys struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Header  string `mapstructure:"header"`
+	// File keeps the keys in a JSON file; they are kept in memory if empty.
+	File        string `mapstructure:"file"`
+	DefaultTier string `mapstructure:"default_tier"`
+	// Tiers maps tier names to requests per minute.
+	Tiers            map[string]int `mapstructure:"tiers"`
+	LastUsedInterval time.Duration  `mapstructure:"last_used_interval"`
+}
+
+type Versioning struct {
+	Unversioned  bool          `mapstructure:"unversioned"`
+	Deprecations []Deprecation `mapstructure:"deprecations"`
+}
+
+type Deprecation struct {
+	Prefix    string    `mapstructure:"prefix"`
+	Successor string    `mapstructure:"successor"`
+	Date      time.Time `mapstructure:"date"`
+	Sunset    time.Time `mapstructure:"sunset"`
+	Link      string    `mapstructure:"link"`
+}
+
 func New() *Config {
 	_ = godotenv.Load()
 
@@ -51,7 +241,12 @@ func New() *Config {
 		panic(err)
 	}
 	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
+	hook := mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+		mapstructure.StringToTimeHookFunc(time.RFC3339),
+	)
+	if err := viper.Unmarshal(&config, viper.DecodeHook(hook)); err != nil {
 		panic(err)
 	}
 
@@ -66,4 +261,5 @@ func BindEnv() {
 	viper.BindEnv("auth.host", "AUTH_HOST")
 
 	viper.BindEnv("access_token_secret", "ACCESS_TOKEN_SECRET")
+	viper.BindEnv("calendar.feed_secret", "FEED_TOKEN_SECRET")
 }
@@ -0,0 +1,86 @@
+package etag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// variantSeparator and encodingSeparator can't occur in the hex hash,
+	// so the parts of a tag can be told apart.
+	variantSeparator  = "."
+	encodingSeparator = "+"
+)
+
+// FromMessage returns a strong entity tag of the deterministic binary encoding
+// of m, so it does not depend on the JSON rendering options. A non-empty
+// variant names the representation, e.g. the response format, and is appended
+// as "<hash>.<variant>", so that every representation of m has its own tag.
+func FromMessage(m proto.Message, variant string) (string, error) {
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(m)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	tag := hex.EncodeToString(sum[:16])
+	if variant != "" {
+		tag += variantSeparator + variant
+	}
+	return `"` + tag + `"`, nil
+}
+
+// WithEncoding returns the tag of the content-coded representation, which is
+// a different representation with its own tag: "<tag>+<encoding>".
+func WithEncoding(etag, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + encodingSeparator + encoding + `"`
+}
+
+// WithoutEncoding removes the encoding added by WithEncoding from every tag
+// listed in an If-Match or If-None-Match header, so that handlers can compare
+// them with the tags of the unencoded representations.
+func WithoutEncoding(header string) string {
+	if !strings.Contains(header, encodingSeparator) {
+		return header
+	}
+	candidates := strings.Split(header, ",")
+	for i, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if tag, _, ok := strings.Cut(candidate, encodingSeparator); ok && strings.HasSuffix(candidate, `"`) {
+			candidate = tag + `"`
+		}
+		candidates[i] = candidate
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// Match reports whether etag matches one of the entity tags listed in an
+// If-Match (strong comparison) or If-None-Match (weak comparison) header.
+// Strong comparison requires both tags to be strong and identical, so an
+// If-Match precondition holds only for the representation the client read.
+func Match(header, etag string, weak bool) bool {
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if !strings.HasPrefix(candidate, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package etag
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		header string
+		etag   string
+		weak   bool
+		want   bool
+	}{
+		{`"abc.json"`, `"abc.json"`, false, true},
+		{`"abc.json"`, `"abc.json"`, true, true},
+		{`"xyz", "abc.json"`, `"abc.json"`, false, true},
+		{`*`, `"abc.json"`, false, true},
+		{`"abc.protobuf"`, `"abc.json"`, false, false},
+		{`"abc.protobuf"`, `"abc.json"`, true, false},
+		{`"abc"`, `"abc.json"`, false, false},
+		{`W/"abc.json"`, `"abc.json"`, false, false},
+		{`W/"abc.json"`, `"abc.json"`, true, true},
+		{`"abc.json+gzip"`, `"abc.json"`, true, false},
+		{`"abc.json"`, "", true, false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.header, tt.etag, tt.weak); got != tt.want {
+			t.Errorf("Match(%s, %s, weak %v) = %v, want %v", tt.header, tt.etag, tt.weak, got, tt.want)
+		}
+	}
+}
+
+func TestWithEncoding(t *testing.T) {
+	tests := []struct {
+		etag string
+		want string
+	}{
+		{`"abc.json"`, `"abc.json+gzip"`},
+		{`W/"abc"`, `W/"abc+gzip"`},
+		{`abc`, `abc`},
+	}
+	for _, tt := range tests {
+		if got := WithEncoding(tt.etag, "gzip"); got != tt.want {
+			t.Errorf("WithEncoding(%s) = %s, want %s", tt.etag, got, tt.want)
+		}
+	}
+}
+
+func TestWithoutEncoding(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{`"abc.json"`, `"abc.json"`},
+		{`"abc.json+gzip"`, `"abc.json"`},
+		{`W/"abc+br", "def.json+zstd"`, `W/"abc", "def.json"`},
+		{`*`, `*`},
+	}
+	for _, tt := range tests {
+		if got := WithoutEncoding(tt.header); got != tt.want {
+			t.Errorf("WithoutEncoding(%s) = %s, want %s", tt.header, got, tt.want)
+		}
+	}
+}
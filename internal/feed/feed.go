@@ -0,0 +1,124 @@
+package feed
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinSecretLength is the minimum length of the signing secret; shorter ones,
+// including an unset one, would let anyone forge tokens.
+const MinSecretLength = 32
+
+var (
+	ErrWeakSecret   = fmt.Errorf("feed secret must be at least %d bytes long", MinSecretLength)
+	ErrInvalidToken = errors.New("feed token is invalid")
+	ErrExpiredToken = errors.New("feed token is expired")
+	ErrRevokedToken = errors.New("feed token is revoked")
+)
+
+// Store keeps the token generation of every user. Tokens are issued for the
+// current generation, so bumping it revokes all tokens issued before.
+type Store interface {
+	Generation(userID string) (uint64, error)
+	Revoke(userID string) error
+}
+
+// Signer issues and verifies feed tokens: HMAC-SHA256 signed, URL-safe tokens
+// that identify a user to clients which can't send an Authorization header,
+// such as calendar apps.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	store  Store
+}
+
+// NewSigner creates a Signer. A zero ttl issues tokens that don't expire.
+func NewSigner(secret string, ttl time.Duration, store Store) (*Signer, error) {
+	if len(secret) < MinSecretLength {
+		return nil, ErrWeakSecret
+	}
+	return &Signer{
+		secret: []byte(secret),
+		ttl:    ttl,
+		store:  store,
+	}, nil
+}
+
+func (s *Signer) Issue(userID string) (string, error) {
+	generation, err := s.store.Generation(userID)
+	if err != nil {
+		return "", err
+	}
+
+	var expires int64
+	if s.ttl > 0 {
+		expires = time.Now().Add(s.ttl).Unix()
+	}
+
+	payload := strings.Join([]string{
+		userID,
+		strconv.FormatUint(generation, 10),
+		strconv.FormatInt(expires, 10),
+	}, ":")
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(s.sign(payload)), nil
+}
+
+// Verify checks the token and returns the ID of the user it was issued to.
+func (s *Signer) Verify(token string) (string, error) {
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, s.sign(string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	parts := strings.Split(string(payload), ":")
+	if len(parts) != 3 {
+		return "", ErrInvalidToken
+	}
+	userID := parts[0]
+	generation, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	expires, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+
+	if expires != 0 && time.Now().Unix() >= expires {
+		return "", ErrExpiredToken
+	}
+	current, err := s.store.Generation(userID)
+	if err != nil {
+		return "", err
+	}
+	if generation != current {
+		return "", ErrRevokedToken
+	}
+	return userID, nil
+}
+
+// Revoke invalidates all tokens issued to the user so far.
+func (s *Signer) Revoke(userID string) error {
+	return s.store.Revoke(userID)
+}
+
+func (s *Signer) sign(payload string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,156 @@
+package feed
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestNewSigner(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+		err    error
+	}{
+		{"empty", "", ErrWeakSecret},
+		{"short", testSecret[:MinSecretLength-1], ErrWeakSecret},
+		{"minimum", testSecret, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSigner(tt.secret, 0, NewMemoryStore())
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("NewSigner() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestSignerVerify(t *testing.T) {
+	signer, err := NewSigner(testSecret, time.Hour, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := signer.Issue("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := NewSigner(strings.Repeat("x", MinSecretLength), time.Hour, NewMemoryStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged, err := other.Issue("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, signature, _ := strings.Cut(token, ".")
+	tampered := base64.RawURLEncoding.EncodeToString([]byte("user-2:0:0")) + "." + signature
+	expired := base64.RawURLEncoding.EncodeToString([]byte("user-1:0:1")) + "." +
+		base64.RawURLEncoding.EncodeToString(signer.sign("user-1:0:1"))
+
+	tests := []struct {
+		name   string
+		token  string
+		userID string
+		err    error
+	}{
+		{"valid", token, "user-1", nil},
+		{"expired", expired, "", ErrExpiredToken},
+		{"other secret", forged, "", ErrInvalidToken},
+		{"tampered payload", tampered, "", ErrInvalidToken},
+		{"no signature", payload, "", ErrInvalidToken},
+		{"bad encoding", "!!!." + signature, "", ErrInvalidToken},
+		{"empty", "", "", ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userID, err := signer.Verify(tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.err)
+			}
+			if userID != tt.userID {
+				t.Errorf("Verify() = %q, want %q", userID, tt.userID)
+			}
+		})
+	}
+}
+
+func TestSignerRevoke(t *testing.T) {
+	stores := []struct {
+		name  string
+		store func(t *testing.T) Store
+	}{
+		{"memory", func(t *testing.T) Store { return NewMemoryStore() }},
+		{"file", func(t *testing.T) Store {
+			store, err := NewFileStore(filepath.Join(t.TempDir(), "revocations.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		}},
+	}
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := NewSigner(testSecret, 0, tt.store(t))
+			if err != nil {
+				t.Fatal(err)
+			}
+			old, err := signer.Issue("user-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := signer.Revoke("user-1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := signer.Verify(old); !errors.Is(err, ErrRevokedToken) {
+				t.Errorf("Verify(old) error = %v, want %v", err, ErrRevokedToken)
+			}
+
+			current, err := signer.Issue("user-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := signer.Verify(current); err != nil {
+				t.Errorf("Verify(current) error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "revocations.json")
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSigner(testSecret, 0, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := signer.Issue("user-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signer.Revoke("user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err = NewSigner(testSecret, 0, reloaded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.Verify(token); !errors.Is(err, ErrRevokedToken) {
+		t.Errorf("Verify() after reload error = %v, want %v", err, ErrRevokedToken)
+	}
+}
@@ -0,0 +1,76 @@
+package feed
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore keeps generations in memory and writes them to a JSON file on
+// every revocation, so that revoked tokens stay revoked after a restart.
+type FileStore struct {
+	*MemoryStore
+	path string
+}
+
+// NewFileStore loads the generations from path, which is created on the
+// first revocation if it doesn't exist.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(),
+		path:        path,
+	}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &s.generations); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) Revoke(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generations[userID]++
+	if err := s.flush(); err != nil {
+		// The revocation must not look successful if it is lost on restart.
+		s.generations[userID]--
+		return err
+	}
+	return nil
+}
+
+// flush replaces the file, so that a crash never leaves it half-written.
+// s.mu must be held.
+func (s *FileStore) flush() error {
+	b, err := json.Marshal(s.generations)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
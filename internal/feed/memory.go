@@ -0,0 +1,31 @@
+package feed
+
+import "sync"
+
+// MemoryStore keeps generations in process memory; revocations are lost on
+// restart.
+type MemoryStore struct {
+	mu          sync.Mutex
+	generations map[string]uint64
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		generations: make(map[string]uint64),
+	}
+}
+
+func (s *MemoryStore) Generation(userID string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.generations[userID], nil
+}
+
+func (s *MemoryStore) Revoke(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.generations[userID]++
+	return nil
+}
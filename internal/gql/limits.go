@@ -0,0 +1,111 @@
+package gql
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// Limits bound the cost of a query before it is executed.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+	// Lists maps list fields to the argument giving their size. Lists
+	// without the argument (or with "" as argument) count as DefaultListSize.
+	Lists           map[string]string
+	DefaultListSize int
+}
+
+// Check computes the depth and complexity of the operation. Every field costs
+// 1 and the cost of the selection of a list field is multiplied by its size.
+func (l Limits) Check(doc *ast.Document, operationName string, variables map[string]any) error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		switch def := def.(type) {
+		case *ast.FragmentDefinition:
+			fragments[def.Name.Value] = def
+		case *ast.OperationDefinition:
+			if operation == nil || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	if operation == nil {
+		return nil
+	}
+
+	a := analyzer{limits: l, fragments: fragments, variables: variables}
+	depth, complexity := a.selectionSet(operation.SelectionSet)
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return fmt.Errorf("query depth %d exceeds the limit of %d", depth, l.MaxDepth)
+	}
+	if l.MaxComplexity > 0 && complexity > l.MaxComplexity {
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", complexity, l.MaxComplexity)
+	}
+	return nil
+}
+
+type analyzer struct {
+	limits    Limits
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+}
+
+func (a analyzer) selectionSet(set *ast.SelectionSet) (int, int) {
+	if set == nil {
+		return 0, 0
+	}
+	depth, complexity := 0, 0
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			d, c = a.field(selection)
+		case *ast.InlineFragment:
+			d, c = a.selectionSet(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			if fragment, ok := a.fragments[selection.Name.Value]; ok {
+				d, c = a.selectionSet(fragment.SelectionSet)
+			}
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+func (a analyzer) field(field *ast.Field) (int, int) {
+	depth, complexity := a.selectionSet(field.SelectionSet)
+	if arg, ok := a.limits.Lists[field.Name.Value]; ok {
+		complexity *= a.listSize(field, arg)
+	}
+	return depth + 1, complexity + 1
+}
+
+func (a analyzer) listSize(field *ast.Field, name string) int {
+	for _, arg := range field.Arguments {
+		if name == "" || arg.Name.Value != name {
+			continue
+		}
+		switch v := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(v.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			switch n := a.variables[v.Name.Value].(type) {
+			case float64:
+				if n > 0 {
+					return int(n)
+				}
+			case int:
+				if n > 0 {
+					return n
+				}
+			}
+		}
+	}
+	return max(a.limits.DefaultListSize, 1)
+}
@@ -0,0 +1,69 @@
+package gql
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+var ErrNotLoaded = errors.New("not loaded")
+
+// Loader batches the keys requested while a level of the query is resolved
+// and fetches them with one call when the first result is needed. A Loader
+// lives for a single request.
+type Loader[K comparable, V any] struct {
+	mu      sync.Mutex
+	fetch   func(keys []K) (map[K]V, map[K]error)
+	pending []K
+	values  map[K]V
+	errs    map[K]error
+}
+
+func NewLoader[K comparable, V any](fetch func(keys []K) (map[K]V, map[K]error)) *Loader[K, V] {
+	return &Loader[K, V]{
+		fetch:  fetch,
+		values: make(map[K]V),
+		errs:   make(map[K]error),
+	}
+}
+
+// Load queues key and returns a thunk that resolves it. graphql-go calls the
+// thunks after every field of the level has been resolved.
+func (l *Loader[K, V]) Load(key K) func() (any, error) {
+	l.mu.Lock()
+	_, loaded := l.values[key]
+	_, failed := l.errs[key]
+	if !loaded && !failed && !slices.Contains(l.pending, key) {
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (any, error) {
+		return l.get(key)
+	}
+}
+
+func (l *Loader[K, V]) get(key K) (V, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.pending) > 0 {
+		keys := l.pending
+		l.pending = nil
+		values, errs := l.fetch(keys)
+		for _, k := range keys {
+			if v, ok := values[k]; ok {
+				l.values[k] = v
+			} else if err, ok := errs[k]; ok {
+				l.errs[k] = err
+			} else {
+				l.errs[k] = ErrNotLoaded
+			}
+		}
+	}
+	if err, ok := l.errs[key]; ok {
+		var zero V
+		return zero, err
+	}
+	return l.values[key], nil
+}
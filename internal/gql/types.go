@@ -0,0 +1,130 @@
+// Package gql holds the GraphQL building blocks that do not depend on the
+// gateway handlers: types derived from protobuf messages, query limits and a
+// per-request batching loader.
+package gql
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/graphql-go/graphql"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var timestampName = (&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName()
+
+// Object derives a GraphQL object from the fields of msg, named by their
+// JSON names. Resolved values must be messages of the same type. extra adds
+// fields or replaces derived ones, e.g. to turn a UUID into a joined object.
+func Object(name string, msg proto.Message, extra graphql.Fields) *graphql.Object {
+	fields := graphql.Fields{}
+	descriptor := msg.ProtoReflect().Descriptor()
+	for i := range descriptor.Fields().Len() {
+		fd := descriptor.Fields().Get(i)
+		typ := scalar(fd)
+		if typ == nil {
+			continue
+		}
+		fields[fd.JSONName()] = &graphql.Field{
+			Type: typ,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				m, ok := p.Source.(proto.Message)
+				if !ok {
+					return nil, nil
+				}
+				return value(m.ProtoReflect().Get(fd), fd), nil
+			},
+		}
+	}
+	for name, field := range extra {
+		fields[name] = field
+	}
+	return graphql.NewObject(graphql.ObjectConfig{Name: name, Fields: fields})
+}
+
+// InputObject derives a GraphQL input object from msg without the excluded
+// proto field names. Use Decode to fill a message from the input.
+func InputObject(name string, msg proto.Message, exclude ...string) *graphql.InputObject {
+	fields := graphql.InputObjectConfigFieldMap{}
+	descriptor := msg.ProtoReflect().Descriptor()
+	for i := range descriptor.Fields().Len() {
+		fd := descriptor.Fields().Get(i)
+		typ := scalar(fd)
+		if typ == nil || slices.Contains(exclude, string(fd.Name())) {
+			continue
+		}
+		fields[fd.JSONName()] = &graphql.InputObjectFieldConfig{Type: typ}
+	}
+	return graphql.NewInputObject(graphql.InputObjectConfig{Name: name, Fields: fields})
+}
+
+// Decode fills msg from an input object argument.
+func Decode(input any, msg proto.Message) error {
+	raw, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+	return protojson.Unmarshal(raw, msg)
+}
+
+func scalar(fd protoreflect.FieldDescriptor) graphql.Output {
+	var typ graphql.Output
+	switch fd.Kind() {
+	case protoreflect.StringKind, protoreflect.EnumKind:
+		typ = graphql.String
+	case protoreflect.BoolKind:
+		typ = graphql.Boolean
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind,
+		protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		typ = graphql.Int
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind,
+		protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		// GraphQL Int is 32-bit, 64-bit values are passed as IDs (strings).
+		typ = graphql.ID
+	case protoreflect.FloatKind, protoreflect.DoubleKind:
+		typ = graphql.Float
+	case protoreflect.MessageKind:
+		if fd.Message().FullName() != timestampName {
+			return nil
+		}
+		typ = graphql.DateTime
+	default:
+		return nil
+	}
+	if fd.IsList() {
+		return graphql.NewList(typ)
+	}
+	return typ
+}
+
+func value(v protoreflect.Value, fd protoreflect.FieldDescriptor) any {
+	if fd.IsList() {
+		list := v.List()
+		out := make([]any, list.Len())
+		for i := range list.Len() {
+			out[i] = single(list.Get(i), fd)
+		}
+		return out
+	}
+	return single(v, fd)
+}
+
+func single(v protoreflect.Value, fd protoreflect.FieldDescriptor) any {
+	switch fd.Kind() {
+	case protoreflect.MessageKind:
+		ts, ok := v.Message().Interface().(*timestamppb.Timestamp)
+		if !ok || !v.Message().IsValid() {
+			return nil
+		}
+		return ts.AsTime()
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return nil
+	}
+	return v.Interface()
+}
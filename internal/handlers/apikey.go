@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+type APIKey struct {
+	logger *slog.Logger
+	config *config.Config
+	codec  *codec.Codec
+	store  apikey.Store
+}
+
+type createAPIKeyRequest struct {
+	Name      string    `json:"name"`
+	Owner     string    `json:"owner"`
+	Scopes    []string  `json:"scopes"`
+	Tier      string    `json:"tier"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewAPIKey(logger *slog.Logger, config *config.Config, store apikey.Store) *APIKey {
+	return &APIKey{
+		logger: logger,
+		config: config,
+		codec:  codec.New(config.Protojson),
+		store:  store,
+	}
+}
+
+// Create issues a key acting as its owner, by default the admin issuing it.
+// The key is only returned here.
+func (a *APIKey) Create(c *gin.Context) {
+	if !a.admin(c) {
+		return
+	}
+
+	var req createAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		a.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "JSON is incorrect",
+			},
+		)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !slices.Contains(apikey.Scopes, scope) {
+			a.codec.Render(
+				c,
+				http.StatusBadRequest,
+				gin.H{
+					"code":    http.StatusBadRequest,
+					"message": "Unknown scope " + scope,
+				},
+			)
+			return
+		}
+	}
+	if req.Tier == "" {
+		req.Tier = a.config.APIKeys.DefaultTier
+	}
+	if _, ok := a.config.APIKeys.Tiers[req.Tier]; !ok {
+		a.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "Unknown tier " + req.Tier,
+			},
+		)
+		return
+	}
+	if !req.ExpiresAt.IsZero() && req.ExpiresAt.Before(time.Now()) {
+		a.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "Expiry must be in the future",
+			},
+		)
+		return
+	}
+	if req.Owner == "" {
+		req.Owner = c.GetString("user_id")
+	}
+
+	key := apikey.New(req.Name, req.Owner, req.Scopes, req.Tier, req.ExpiresAt)
+	raw := key.Rotate()
+	if err := a.store.Save(key); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	key.Hash = ""
+
+	a.codec.Render(
+		c,
+		http.StatusCreated,
+		gin.H{
+			"code":    http.StatusCreated,
+			"message": "API key created",
+			"api_key": raw,
+			"key":     key,
+		},
+	)
+}
+
+func (a *APIKey) GetAll(c *gin.Context) {
+	if !a.admin(c) {
+		return
+	}
+
+	keys, err := a.store.Keys()
+	if err != nil {
+		a.internalError(c, err)
+		return
+	}
+	for _, key := range keys {
+		key.Hash = ""
+	}
+
+	a.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":    http.StatusOK,
+			"message": "Successful getting API keys",
+			"keys":    keys,
+		},
+	)
+}
+
+func (a *APIKey) GetById(c *gin.Context) {
+	key, ok := a.key(c)
+	if !ok {
+		return
+	}
+	key.Hash = ""
+
+	a.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":    http.StatusOK,
+			"message": "Successful getting API key",
+			"key":     key,
+		},
+	)
+}
+
+// Rotate replaces the secret of a key; the old key stops working at once.
+func (a *APIKey) Rotate(c *gin.Context) {
+	key, ok := a.key(c)
+	if !ok {
+		return
+	}
+	raw := key.Rotate()
+	key.RotatedAt = time.Now().UTC()
+	if err := a.store.Save(key); err != nil {
+		a.internalError(c, err)
+		return
+	}
+	key.Hash = ""
+
+	a.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":    http.StatusOK,
+			"message": "API key rotated",
+			"api_key": raw,
+			"key":     key,
+		},
+	)
+}
+
+// DeleteById revokes a key.
+func (a *APIKey) DeleteById(c *gin.Context) {
+	key, ok := a.key(c)
+	if !ok {
+		return
+	}
+	if err := a.store.Delete(key.ID); err != nil {
+		a.internalError(c, err)
+		return
+	}
+
+	a.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":    http.StatusOK,
+			"message": "API key revoked",
+		},
+	)
+}
+
+func (a *APIKey) admin(c *gin.Context) bool {
+	if !c.GetBool("is_admin") {
+		a.codec.Render(
+			c,
+			http.StatusForbidden,
+			gin.H{
+				"code":    http.StatusForbidden,
+				"message": "The user does not have access to the requested resource.",
+			},
+		)
+		return false
+	}
+	return true
+}
+
+func (a *APIKey) key(c *gin.Context) (*apikey.Key, bool) {
+	if !a.admin(c) {
+		return nil, false
+	}
+
+	key, err := a.store.Key(c.Param("id"))
+	if errors.Is(err, apikey.ErrNotFound) {
+		a.codec.Render(
+			c,
+			http.StatusNotFound,
+			gin.H{
+				"code":    http.StatusNotFound,
+				"message": "Not found",
+			},
+		)
+		return nil, false
+	}
+	if err != nil {
+		a.internalError(c, err)
+		return nil, false
+	}
+	return key, true
+}
+
+func (a *APIKey) internalError(c *gin.Context, err error) {
+	a.logger.Error("API key store failed", slog.String("error", err.Error()))
+	a.codec.Render(
+		c,
+		http.StatusInternalServerError,
+		gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "Internal error",
+		},
+	)
+}
@@ -2,26 +2,32 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
 
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
 	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/session"
 	pb "github.com/Estriper0/protobuf/gen/auth"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
 type Auth struct {
 	logger     *slog.Logger
 	config     *config.Config
+	codec      *codec.Codec
 	authClient pb.AuthClient
+	refresher  *session.Refresher
 }
 
-func NewAuth(logger *slog.Logger, config *config.Config) *Auth {
+func NewAuth(logger *slog.Logger, config *config.Config, refresher *session.Refresher) *Auth {
 	conn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Auth.Host, config.Auth.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		panic(err)
@@ -30,7 +36,9 @@ func NewAuth(logger *slog.Logger, config *config.Config) *Auth {
 	return &Auth{
 		logger:     logger,
 		config:     config,
+		codec:      codec.New(config.Protojson),
 		authClient: pb.NewAuthClient(conn),
+		refresher:  refresher,
 	}
 }
 
@@ -40,9 +48,10 @@ func (a *Auth) Register(c *gin.Context) {
 
 	var req pb.RegisterRequest
 
-	err := c.ShouldBindJSON(&req)
+	err := a.codec.Bind(c, &req)
 	if err != nil {
-		c.JSON(
+		a.codec.Render(
+			c,
 			http.StatusBadRequest,
 			gin.H{
 				"code":    http.StatusBadRequest,
@@ -56,7 +65,8 @@ func (a *Auth) Register(c *gin.Context) {
 	resp, err := a.authClient.Register(ctx, &req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusGatewayTimeout,
 				gin.H{
 					"code":    http.StatusGatewayTimeout,
@@ -70,7 +80,8 @@ func (a *Auth) Register(c *gin.Context) {
 		code := st.Code()
 		switch code {
 		case codes.AlreadyExists:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusConflict,
 				gin.H{
 					"code":    http.StatusConflict,
@@ -79,16 +90,18 @@ func (a *Auth) Register(c *gin.Context) {
 				},
 			)
 		case codes.InvalidArgument:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusBadRequest,
 				gin.H{
 					"code":    http.StatusBadRequest,
 					"user_id": nil,
-					"message": err.Error(),
+					"message": st.Message(),
 				},
 			)
 		case codes.Internal:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusInternalServerError,
 				gin.H{
 					"code":    http.StatusInternalServerError,
@@ -96,16 +109,28 @@ func (a *Auth) Register(c *gin.Context) {
 					"message": "Internal error",
 				},
 			)
+		default:
+			a.codec.Render(
+				c,
+				http.StatusBadGateway,
+				gin.H{
+					"code":    http.StatusBadGateway,
+					"user_id": nil,
+					"message": "Upstream service error",
+				},
+			)
 		}
 		return
 	}
-	c.JSON(
+	a.codec.RenderMessage(
+		c,
 		http.StatusCreated,
 		gin.H{
 			"code":    http.StatusCreated,
 			"user_id": resp.UserUuid,
 			"message": fmt.Sprintf("User with ID=%s was registered", resp.UserUuid),
 		},
+		resp,
 	)
 }
 
@@ -115,9 +140,10 @@ func (a *Auth) Login(c *gin.Context) {
 
 	var req pb.LoginRequest
 
-	err := c.ShouldBindJSON(&req)
+	err := a.codec.Bind(c, &req)
 	if err != nil {
-		c.JSON(
+		a.codec.Render(
+			c,
 			http.StatusBadRequest,
 			gin.H{
 				"code":          http.StatusBadRequest,
@@ -132,7 +158,8 @@ func (a *Auth) Login(c *gin.Context) {
 	resp, err := a.authClient.Login(ctx, &req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusGatewayTimeout,
 				gin.H{
 					"code":          http.StatusGatewayTimeout,
@@ -147,7 +174,8 @@ func (a *Auth) Login(c *gin.Context) {
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusBadRequest,
 				gin.H{
 					"code":          http.StatusBadRequest,
@@ -157,7 +185,8 @@ func (a *Auth) Login(c *gin.Context) {
 				},
 			)
 		case codes.Internal:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusInternalServerError,
 				gin.H{
 					"code":          http.StatusInternalServerError,
@@ -166,10 +195,36 @@ func (a *Auth) Login(c *gin.Context) {
 					"message":       "Internal error",
 				},
 			)
+		default:
+			a.codec.Render(
+				c,
+				http.StatusBadGateway,
+				gin.H{
+					"code":          http.StatusBadGateway,
+					"access_token":  nil,
+					"refresh_token": nil,
+					"message":       "Upstream service error",
+				},
+			)
 		}
 		return
 	}
-	c.JSON(
+	if a.config.Session.Enabled {
+		a.codec.Render(
+			c,
+			http.StatusOK,
+			gin.H{
+				"code":          http.StatusCreated,
+				"access_token":  nil,
+				"refresh_token": nil,
+				"csrf_token":    session.Start(c, a.config.Session, resp.AccessToken, resp.RefreshToken),
+				"message":       "Successful login user",
+			},
+		)
+		return
+	}
+	a.codec.RenderMessage(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":          http.StatusCreated,
@@ -177,6 +232,7 @@ func (a *Auth) Login(c *gin.Context) {
 			"refresh_token": resp.RefreshToken,
 			"message":       "Successful login user",
 		},
+		resp,
 	)
 }
 
@@ -186,9 +242,10 @@ func (a *Auth) IsAdmin(c *gin.Context) {
 
 	var req pb.IsAdminRequest
 
-	err := c.ShouldBindJSON(&req)
+	err := a.codec.Bind(c, &req)
 	if err != nil {
-		c.JSON(
+		a.codec.Render(
+			c,
 			http.StatusBadRequest,
 			gin.H{
 				"code":    http.StatusBadRequest,
@@ -202,7 +259,8 @@ func (a *Auth) IsAdmin(c *gin.Context) {
 	resp, err := a.authClient.IsAdmin(ctx, &req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusGatewayTimeout,
 				gin.H{
 					"code":    http.StatusGatewayTimeout,
@@ -216,7 +274,8 @@ func (a *Auth) IsAdmin(c *gin.Context) {
 		code := st.Code()
 		switch code {
 		case codes.NotFound:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusNotFound,
 				gin.H{
 					"code":    http.StatusNotFound,
@@ -225,7 +284,8 @@ func (a *Auth) IsAdmin(c *gin.Context) {
 				},
 			)
 		case codes.Internal:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusInternalServerError,
 				gin.H{
 					"code":    http.StatusInternalServerError,
@@ -233,16 +293,28 @@ func (a *Auth) IsAdmin(c *gin.Context) {
 					"message": "Internal error",
 				},
 			)
+		default:
+			a.codec.Render(
+				c,
+				http.StatusBadGateway,
+				gin.H{
+					"code":    http.StatusBadGateway,
+					"isAdmin": nil,
+					"message": "Upstream service error",
+				},
+			)
 		}
 		return
 	}
-	c.JSON(
+	a.codec.RenderMessage(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":    http.StatusCreated,
 			"isAdmin": resp.IsAdmin,
 			"message": "Successful user verification for admin",
 		},
+		resp,
 	)
 }
 
@@ -252,9 +324,10 @@ func (a *Auth) Refresh(c *gin.Context) {
 
 	var req pb.RefreshRequest
 
-	err := c.ShouldBindJSON(&req)
+	err := a.bindRefreshToken(c, &req, &req.RefreshToken)
 	if err != nil {
-		c.JSON(
+		a.codec.Render(
+			c,
 			http.StatusBadRequest,
 			gin.H{
 				"code":          http.StatusBadRequest,
@@ -266,10 +339,17 @@ func (a *Auth) Refresh(c *gin.Context) {
 		return
 	}
 
-	resp, err := a.authClient.Refresh(ctx, &req)
+	var resp *pb.RefreshResponse
+	if a.config.Session.Enabled {
+		// Renewals of expired sessions rotate the same refresh token, so they share the call.
+		resp, err = a.refresher.Renew(ctx, req.RefreshToken)
+	} else {
+		resp, err = a.authClient.Refresh(ctx, &req)
+	}
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusGatewayTimeout,
 				gin.H{
 					"code":          http.StatusGatewayTimeout,
@@ -284,7 +364,8 @@ func (a *Auth) Refresh(c *gin.Context) {
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusUnauthorized,
 				gin.H{
 					"code":          http.StatusUnauthorized,
@@ -294,7 +375,8 @@ func (a *Auth) Refresh(c *gin.Context) {
 				},
 			)
 		case codes.Internal:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusInternalServerError,
 				gin.H{
 					"code":          http.StatusInternalServerError,
@@ -303,10 +385,36 @@ func (a *Auth) Refresh(c *gin.Context) {
 					"message":       "Internal error",
 				},
 			)
+		default:
+			a.codec.Render(
+				c,
+				http.StatusBadGateway,
+				gin.H{
+					"code":          http.StatusBadGateway,
+					"access_token":  nil,
+					"refresh_token": nil,
+					"message":       "Upstream service error",
+				},
+			)
 		}
 		return
 	}
-	c.JSON(
+	if a.config.Session.Enabled {
+		a.codec.Render(
+			c,
+			http.StatusOK,
+			gin.H{
+				"code":          http.StatusOK,
+				"access_token":  nil,
+				"refresh_token": nil,
+				"csrf_token":    session.Start(c, a.config.Session, resp.AccessToken, resp.RefreshToken),
+				"message":       "Successfully refresh tokens",
+			},
+		)
+		return
+	}
+	a.codec.RenderMessage(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":          http.StatusOK,
@@ -314,6 +422,7 @@ func (a *Auth) Refresh(c *gin.Context) {
 			"refresh_token": resp.RefreshToken,
 			"message":       "Successfully refresh tokens",
 		},
+		resp,
 	)
 }
 
@@ -323,9 +432,10 @@ func (a *Auth) Logout(c *gin.Context) {
 
 	var req pb.LogoutRequest
 
-	err := c.ShouldBindJSON(&req)
+	err := a.bindRefreshToken(c, &req, &req.RefreshToken)
 	if err != nil {
-		c.JSON(
+		a.codec.Render(
+			c,
 			http.StatusBadRequest,
 			gin.H{
 				"code":    http.StatusBadRequest,
@@ -337,7 +447,8 @@ func (a *Auth) Logout(c *gin.Context) {
 	_, err = a.authClient.Logout(ctx, &req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusGatewayTimeout,
 				gin.H{
 					"code":    http.StatusGatewayTimeout,
@@ -350,7 +461,8 @@ func (a *Auth) Logout(c *gin.Context) {
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusUnauthorized,
 				gin.H{
 					"code":    http.StatusUnauthorized,
@@ -358,17 +470,31 @@ func (a *Auth) Logout(c *gin.Context) {
 				},
 			)
 		case codes.Internal:
-			c.JSON(
+			a.codec.Render(
+				c,
 				http.StatusInternalServerError,
 				gin.H{
 					"code":    http.StatusInternalServerError,
 					"message": "Internal error",
 				},
 			)
+		default:
+			a.codec.Render(
+				c,
+				http.StatusBadGateway,
+				gin.H{
+					"code":    http.StatusBadGateway,
+					"message": "Upstream service error",
+				},
+			)
 		}
 		return
 	}
-	c.JSON(
+	if a.config.Session.Enabled {
+		session.End(c, a.config.Session)
+	}
+	a.codec.Render(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":    http.StatusOK,
@@ -376,3 +502,19 @@ func (a *Auth) Logout(c *gin.Context) {
 		},
 	)
 }
+
+// bindRefreshToken binds the request and takes the refresh token from the
+// session cookie if the body has none.
+func (a *Auth) bindRefreshToken(c *gin.Context, req proto.Message, refreshToken *string) error {
+	err := a.codec.Bind(c, req)
+	if errors.Is(err, codec.ErrEmptyBody) && a.config.Session.Enabled {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	if *refreshToken == "" {
+		*refreshToken = session.RefreshToken(c, a.config.Session)
+	}
+	return nil
+}
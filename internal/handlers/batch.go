@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// inheritedHeaders are copied from the batch request to every sub-request
+// unless the sub-request sets them itself.
+var inheritedHeaders = []string{"Authorization", "Cookie", "Accept", "Accept-Language", "User-Agent", "X-Forwarded-For", "X-Forwarded-Proto"}
+
+// versionPrefix matches the version group a sub-request is routed to.
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+var batchMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+type Batch struct {
+	logger  *slog.Logger
+	config  *config.Config
+	codec   *codec.Codec
+	handler http.Handler
+}
+
+type batchRequest struct {
+	Requests []batchItem `json:"requests"`
+}
+
+type batchItem struct {
+	ID      string            `json:"id"`
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+	Body    json.RawMessage   `json:"body"`
+}
+
+type batchResult struct {
+	ID      string            `json:"id"`
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	// cookies are the Set-Cookie values of the sub-response. They go to the
+	// batch response instead of the body, where scripts could read them.
+	cookies []string
+}
+
+// NewBatch creates the batch handler. handler is the router the sub-requests
+// are dispatched to, so they pass the same middleware as regular requests.
+func NewBatch(logger *slog.Logger, config *config.Config, handler http.Handler) *Batch {
+	return &Batch{
+		logger:  logger,
+		config:  config,
+		codec:   codec.New(config.Protojson),
+		handler: handler,
+	}
+}
+
+// Batch executes the sub-requests concurrently and returns their statuses,
+// headers and bodies in request order. Sub-request paths are relative to the
+// API version of the batch endpoint (/events/me for /v1/batch is /v1/events/me).
+func (b *Batch) Batch(c *gin.Context) {
+	var req batchRequest
+	if err := json.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+		b.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "JSON is incorrect",
+			},
+		)
+		return
+	}
+	if len(req.Requests) == 0 {
+		b.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "Batch is empty",
+			},
+		)
+		return
+	}
+	if len(req.Requests) > b.config.Batch.MaxSize {
+		b.codec.Render(
+			c,
+			http.StatusRequestEntityTooLarge,
+			gin.H{
+				"code":    http.StatusRequestEntityTooLarge,
+				"message": fmt.Sprintf("Batch can't have more than %d requests", b.config.Batch.MaxSize),
+			},
+		)
+		return
+	}
+
+	basePath := strings.TrimSuffix(c.FullPath(), "/batch")
+	results := make([]batchResult, len(req.Requests))
+	sem := make(chan struct{}, max(b.config.Batch.Concurrency, 1))
+	var wg sync.WaitGroup
+
+	for i, item := range req.Requests {
+		if item.ID == "" {
+			item.ID = strconv.Itoa(i)
+		}
+		item.Method = strings.ToUpper(item.Method)
+		if message := validateBatchItem(basePath, item); message != "" {
+			results[i] = batchError(item.ID, http.StatusBadRequest, message)
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			results[i] = b.execute(c.Request, basePath, item)
+		}()
+	}
+	wg.Wait()
+	setBatchCookies(c, results)
+
+	b.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":      http.StatusOK,
+			"message":   "Batch executed",
+			"responses": results,
+		},
+	)
+}
+
+func validateBatchItem(basePath string, item batchItem) string {
+	if !slices.Contains(batchMethods, item.Method) {
+		return "Method is not supported"
+	}
+	u, err := url.Parse(item.Path)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return "Path must start with /"
+	}
+	// Streams never finish and nested batches would multiply the limits. The
+	// check is made on the route the sub-request reaches, so that neither
+	// "/v1/batch" sent to the unversioned batch nor "/events/../batch" passes.
+	route := path.Clean(basePath + u.Path)
+	if version := versionPrefix.FindString(route); version != "" {
+		route = "/" + strings.TrimPrefix(route, version)
+	}
+	if route == "/batch" || route == "/ws" || strings.HasSuffix(route, "/stream") {
+		return "Path can't be used in a batch"
+	}
+	return ""
+}
+
+func (b *Batch) execute(parent *http.Request, basePath string, item batchItem) (result batchResult) {
+	defer func() {
+		if err := recover(); err != nil {
+			b.logger.Error(fmt.Sprintf("Panic in batch sub-request: %v", err))
+			result = batchError(item.ID, http.StatusInternalServerError, "Internal error")
+		}
+	}()
+
+	var body []byte
+	if len(item.Body) > 0 && string(item.Body) != "null" {
+		body = item.Body
+	}
+	req, err := http.NewRequestWithContext(parent.Context(), item.Method, basePath+item.Path, bytes.NewReader(body))
+	if err != nil {
+		return batchError(item.ID, http.StatusBadRequest, "Path is invalid")
+	}
+	req.RemoteAddr = parent.RemoteAddr
+	req.Host = parent.Host
+	req.TLS = parent.TLS
+	// The batch request has passed the CSRF check, so its sub-requests would too.
+	for _, name := range append(inheritedHeaders, b.config.Session.CSRFHeader, b.config.APIKeys.Header) {
+		if v := parent.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+	for name, value := range item.Headers {
+		req.Header.Set(name, value)
+	}
+	if body != nil && req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", gin.MIMEJSON)
+	}
+
+	w := &batchRecorder{header: make(http.Header)}
+	b.handler.ServeHTTP(w, req)
+
+	result = batchResult{
+		ID:      item.ID,
+		Status:  w.statusCode(),
+		Headers: make(map[string]string, len(w.header)),
+	}
+	for name, values := range w.header {
+		if name == "Content-Length" {
+			continue
+		}
+		if name == "Set-Cookie" {
+			result.cookies = values
+			continue
+		}
+		result.Headers[name] = strings.Join(values, ", ")
+	}
+	switch {
+	case w.body.Len() == 0:
+	case json.Valid(w.body.Bytes()):
+		result.Body = w.body.Bytes()
+	default:
+		// Non-JSON bodies (CSV, iCalendar, ...) are embedded as a string.
+		result.Body, _ = json.Marshal(w.body.String())
+	}
+	return result
+}
+
+// setBatchCookies sets the cookies of the sub-responses on the batch response,
+// so that a session renewed by a sub-request reaches the client. Of cookies
+// with the same name, the one of the last sub-request wins.
+func setBatchCookies(c *gin.Context, results []batchResult) {
+	var names []string
+	cookies := make(map[string]string)
+	for _, result := range results {
+		for _, v := range result.cookies {
+			cookie, err := http.ParseSetCookie(v)
+			if err != nil {
+				continue
+			}
+			if _, ok := cookies[cookie.Name]; !ok {
+				names = append(names, cookie.Name)
+			}
+			cookies[cookie.Name] = v
+		}
+	}
+	for _, name := range names {
+		c.Writer.Header().Add("Set-Cookie", cookies[name])
+	}
+}
+
+func batchError(id string, status int, message string) batchResult {
+	body, _ := json.Marshal(gin.H{"code": status, "message": message})
+	return batchResult{ID: id, Status: status, Body: body}
+}
+
+// batchRecorder collects the response of a sub-request.
+type batchRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *batchRecorder) Header() http.Header {
+	return w.header
+}
+
+func (w *batchRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *batchRecorder) Write(b []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(b)
+}
+
+func (w *batchRecorder) Flush() {}
+
+func (w *batchRecorder) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestBatch(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	r := gin.New()
+	v1 := r.Group("/v1")
+	v1.GET("/events/:id", func(c *gin.Context) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		c.JSON(http.StatusOK, gin.H{
+			"id":            c.Param("id"),
+			"authorization": c.GetHeader("Authorization"),
+			"language":      c.GetHeader("Accept-Language"),
+		})
+	})
+	v1.POST("/events/", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Header("Location", "/v1/events/9")
+		c.Data(http.StatusCreated, c.ContentType(), body)
+	})
+	v1.GET("/calendar", func(c *gin.Context) { c.String(http.StatusOK, "BEGIN:VCALENDAR") })
+	v1.DELETE("/events/:id", func(c *gin.Context) { panic("boom") })
+	b := NewBatch(slog.New(slog.NewTextHandler(io.Discard, nil)), &config.Config{
+		Batch: config.Batch{MaxSize: 10, Concurrency: 2},
+	}, r)
+	v1.POST("/batch", b.Batch)
+
+	do := func(body string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer outer")
+		req.Header.Set("Accept-Language", "de")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		var resp map[string]any
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("body %s: %v", w.Body, err)
+		}
+		return w.Code, resp
+	}
+
+	status, resp := do(`{"requests":[
+		{"id":"a","method":"get","path":"/events/1"},
+		{"method":"GET","path":"/events/2","headers":{"Authorization":"Bearer inner"}},
+		{"id":"c","method":"POST","path":"/events/","body":{"title":"Go"}},
+		{"id":"d","method":"GET","path":"/calendar"},
+		{"id":"e","method":"DELETE","path":"/events/1"},
+		{"id":"f","method":"TRACE","path":"/events/1"},
+		{"id":"g","method":"GET","path":"//evil.example/events"},
+		{"id":"h","method":"GET","path":"/events/stream"},
+		{"id":"i","method":"POST","path":"/batch"},
+		{"id":"j","method":"GET","path":"/events/3"}
+	]}`)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %v", status, http.StatusOK, resp)
+	}
+	responses := resp["responses"].([]any)
+	result := func(i int) map[string]any { return responses[i].(map[string]any) }
+	body := func(i int) map[string]any { b, _ := result(i)["body"].(map[string]any); return b }
+
+	wantStatus := []float64{200, 200, 201, 200, 500, 400, 400, 400, 400, 200}
+	for i, want := range wantStatus {
+		if got := result(i)["status"]; got != want {
+			t.Errorf("response %d status = %v, want %v", i, got, want)
+		}
+	}
+	if result(0)["id"] != "a" || result(1)["id"] != "1" {
+		t.Errorf("ids = %v, %v, want a and the index 1", result(0)["id"], result(1)["id"])
+	}
+	if body(0)["id"] != "1" || body(9)["id"] != "3" {
+		t.Errorf("responses are out of order: %v", responses)
+	}
+	if body(0)["authorization"] != "Bearer outer" || body(0)["language"] != "de" {
+		t.Errorf("inherited headers = %v", body(0))
+	}
+	if body(1)["authorization"] != "Bearer inner" {
+		t.Errorf("sub-request header = %v, want it to override the batch header", body(1)["authorization"])
+	}
+	if body(2)["title"] != "Go" || result(2)["headers"].(map[string]any)["Location"] != "/v1/events/9" {
+		t.Errorf("POST result = %v", result(2))
+	}
+	if result(3)["body"] != "BEGIN:VCALENDAR" {
+		t.Errorf("non-JSON body = %#v, want it embedded as a string", result(3)["body"])
+	}
+	if got := maxRunning.Load(); got > 2 {
+		t.Errorf("%d sub-requests ran at once, want at most 2", got)
+	}
+
+	tooMany := `{"requests":[` + strings.TrimSuffix(strings.Repeat(`{"method":"GET","path":"/events/1"},`, 11), ",") + `]}`
+	for _, tt := range []struct {
+		body   string
+		status int
+	}{
+		{`{"requests":[]}`, http.StatusBadRequest},
+		{`not json`, http.StatusBadRequest},
+		{tooMany, http.StatusRequestEntityTooLarge},
+	} {
+		if status, _ := do(tt.body); status != tt.status {
+			t.Errorf("batch %.30s: status = %d, want %d", tt.body, status, tt.status)
+		}
+	}
+}
+
+func TestBatchCookies(t *testing.T) {
+	r := gin.New()
+	r.GET("/v1/session", func(c *gin.Context) {
+		http.SetCookie(c.Writer, &http.Cookie{Name: "access_token", Value: c.Query("v"), HttpOnly: true})
+		if c.Query("csrf") != "" {
+			http.SetCookie(c.Writer, &http.Cookie{Name: "csrf_token", Value: c.Query("csrf")})
+		}
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	b := NewBatch(slog.New(slog.NewTextHandler(io.Discard, nil)), &config.Config{
+		Batch: config.Batch{MaxSize: 10, Concurrency: 1},
+	}, r)
+	r.POST("/v1/batch", b.Batch)
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch", strings.NewReader(`{"requests":[
+		{"method":"GET","path":"/session?v=a&csrf=t"},
+		{"method":"GET","path":"/session?v=b"}
+	]}`))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	got := make(map[string]string)
+	for _, cookie := range w.Result().Cookies() {
+		if _, ok := got[cookie.Name]; ok {
+			t.Errorf("cookie %s set twice", cookie.Name)
+		}
+		got[cookie.Name] = cookie.Value
+	}
+	if got["access_token"] != "b" || got["csrf_token"] != "t" {
+		t.Errorf("cookies = %v, want access_token=b and csrf_token=t", got)
+	}
+	if strings.Contains(w.Body.String(), "access_token") {
+		t.Errorf("body %s exposes the cookies", w.Body)
+	}
+}
+
+func TestValidateBatchItem(t *testing.T) {
+	tests := []struct {
+		basePath string
+		method   string
+		path     string
+		want     string
+	}{
+		{"/v1", http.MethodGet, "/events/1?expand=creator", ""},
+		{"/v1", http.MethodGet, "events/1", "Path must start with /"},
+		{"/v1", http.MethodGet, "//evil.example/events", "Path must start with /"},
+		{"/v1", http.MethodGet, "http://evil.example/events", "Path must start with /"},
+		{"/v1", http.MethodGet, "/events/stream", "Path can't be used in a batch"},
+		{"/v1", http.MethodGet, "/ws", "Path can't be used in a batch"},
+		{"/v1", http.MethodPost, "/events/../batch", "Path can't be used in a batch"},
+		{"", http.MethodPost, "/v1/batch", "Path can't be used in a batch"},
+		{"", http.MethodGet, "/v2/ws", "Path can't be used in a batch"},
+		{"", http.MethodGet, "/v1/events/1", ""},
+		{"/v1", http.MethodOptions, "/events/1", "Method is not supported"},
+	}
+	for _, tt := range tests {
+		got := validateBatchItem(tt.basePath, batchItem{Method: tt.method, Path: tt.path})
+		if got != tt.want {
+			t.Errorf("validateBatchItem(%q, %s %s) = %q, want %q", tt.basePath, tt.method, tt.path, got, tt.want)
+		}
+	}
+}
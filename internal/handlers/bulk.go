@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidIDs = errors.New("ids must be a comma-separated list of positive numbers")
+
+type bulkRegisterRequest struct {
+	EventIDs []int64 `json:"event_ids"`
+}
+
+// bulkError is the per-ID error of a bulk operation.
+type bulkError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// getByIds serves GET /events/?ids=1,2,3. Events are fetched concurrently;
+// IDs that failed are reported in "errors" instead of failing the request.
+func (e *Event) getByIds(c *gin.Context, raw string) {
+	ids, err := parseIDs(raw, e.config.Bulk.MaxIDs)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "events")
+		return
+	}
+
+	expand, err := parseExpand(c, eventExpansions...)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "events")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
+	defer cancel()
+
+	found := make([]*pb.EventElem, len(ids))
+	failed := fanOut(ctx, ids, e.config.Bulk.Workers, func(ctx context.Context, i int, id int64) error {
+		event, err := e.eventClient.GetById(ctx, &pb.GetByIdRequest{Id: id})
+		if err != nil {
+			return err
+		}
+		found[i] = eventElem(event)
+		return nil
+	})
+
+	events := make(map[string]*pb.EventElem, len(ids))
+	ordered := make([]*pb.EventElem, 0, len(ids))
+	errs := make(map[string]bulkError, len(failed))
+	for i, id := range ids {
+		key := strconv.FormatInt(id, 10)
+		if err, ok := failed[i]; ok {
+			errs[key] = bulkErrorFrom(ctx, err)
+			continue
+		}
+		events[key] = found[i]
+		ordered = append(ordered, found[i])
+	}
+
+	e.codec.RenderMessage(
+		c,
+		http.StatusOK,
+		e.withExpand(ctx, c, expand, ordered, gin.H{
+			"code":    http.StatusOK,
+			"message": "Successful getting events",
+			"events":  events,
+			"errors":  errs,
+		}),
+		&pb.GetAllResponse{Events: ordered},
+	)
+}
+
+// RegisterMany registers the current user for several events. The response
+// is 200 if every registration succeeded and 207 with per-event results otherwise.
+func (e *Event) RegisterMany(c *gin.Context) {
+	var req bulkRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		e.abortWithError(c, http.StatusBadRequest, "JSON is incorrect")
+		return
+	}
+	ids, err := uniqueIDs(req.EventIDs, e.config.Bulk.MaxIDs)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
+	defer cancel()
+
+	userID := c.GetString("user_id")
+	failed := fanOut(ctx, ids, e.config.Bulk.Workers, func(ctx context.Context, _ int, id int64) error {
+		_, err := e.eventClient.Register(ctx, &pb.RegisterRequest{UserId: userID, EventId: id})
+		return err
+	})
+
+	registered := make([]int64, 0, len(ids))
+	errs := make(map[string]bulkError, len(failed))
+	for i, id := range ids {
+		if err, ok := failed[i]; ok {
+			errs[strconv.FormatInt(id, 10)] = bulkErrorFrom(ctx, err)
+			continue
+		}
+		registered = append(registered, id)
+		e.aggregator.Forget(id)
+		e.publish(webhook.RegistrationCreated, gin.H{"event_id": id, "user_id": userID})
+	}
+
+	code, message := http.StatusOK, "Successful user registration for the events"
+	if len(errs) > 0 {
+		code, message = http.StatusMultiStatus, "Registration failed for some events"
+	}
+	e.codec.Render(
+		c,
+		code,
+		gin.H{
+			"code":       code,
+			"message":    message,
+			"registered": registered,
+			"errors":     errs,
+		},
+	)
+}
+
+// fanOut calls fn for every ID with at most workers calls at a time and
+// returns the errors by index.
+func fanOut(ctx context.Context, ids []int64, workers int, fn func(ctx context.Context, i int, id int64) error) map[int]error {
+	jobs := make(chan int)
+	errs := make(map[int]error)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for range min(max(workers, 1), len(ids)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := fn(ctx, i, ids[i]); err != nil {
+					mu.Lock()
+					errs[i] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for i := range ids {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return errs
+}
+
+func parseIDs(raw string, limit int) ([]int64, error) {
+	var ids []int64
+	for part := range strings.SplitSeq(raw, ",") {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, ErrInvalidIDs
+		}
+		ids = append(ids, id)
+	}
+	return uniqueIDs(ids, limit)
+}
+
+// uniqueIDs drops duplicates keeping the order and checks the IDs and their number.
+func uniqueIDs(ids []int64, limit int) ([]int64, error) {
+	seen := make(map[int64]struct{}, len(ids))
+	unique := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if id < 1 {
+			return nil, ErrInvalidIDs
+		}
+		if _, ok := seen[id]; ok {
+			continue
+		}
+		seen[id] = struct{}{}
+		unique = append(unique, id)
+	}
+	if len(unique) == 0 {
+		return nil, ErrInvalidIDs
+	}
+	if len(unique) > limit {
+		return nil, fmt.Errorf("no more than %d ids are allowed", limit)
+	}
+	return unique, nil
+}
+
+func bulkErrorFrom(ctx context.Context, err error) bulkError {
+	code, message := registrationError(ctx, err)
+	return bulkError{Code: code, Message: message}
+}
+
+// registrationError maps an event-service error to an HTTP status and message.
+func registrationError(ctx context.Context, err error) (int, string) {
+	if ctx.Err() == context.DeadlineExceeded {
+		return http.StatusGatewayTimeout, "Request timed out"
+	}
+	st, _ := status.FromError(err)
+	switch st.Code() {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest, st.Message()
+	case codes.ResourceExhausted, codes.AlreadyExists:
+		return http.StatusConflict, st.Message()
+	case codes.NotFound:
+		return http.StatusNotFound, st.Message()
+	}
+	return http.StatusInternalServerError, "Internal error"
+}
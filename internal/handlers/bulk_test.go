@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/aggregate"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+)
+
+func newBulkEvent(t *testing.T) *Event {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	webhooks := webhook.NewDispatcher(logger, webhook.NewMemoryStore(0), config.Webhooks{})
+	t.Cleanup(webhooks.Close)
+	events := &fakeEventClient{events: map[int64]*pb.GetByIdResponse{
+		1: {Id: 1, Title: "Go meetup"},
+		2: {Id: 2, Title: "Rust night"},
+	}}
+	return &Event{
+		logger: logger,
+		config: &config.Config{
+			Timeout: time.Second,
+			Bulk:    config.Bulk{MaxIDs: 3, Workers: 2},
+		},
+		codec:       codec.New(config.Protojson{UseProtoNames: true}),
+		webhooks:    webhooks,
+		aggregator:  aggregate.New(config.Expand{}, nil, events),
+		eventClient: events,
+	}
+}
+
+func TestGetByIds(t *testing.T) {
+	e := newBulkEvent(t)
+
+	tests := []struct {
+		ids    string
+		status int
+		found  []string
+		errors map[string]float64
+	}{
+		{"1,2", http.StatusOK, []string{"1", "2"}, map[string]float64{}},
+		// Duplicates don't count against the limit.
+		{"2, 9, 2, 1", http.StatusOK, []string{"1", "2"}, map[string]float64{"9": http.StatusNotFound}},
+		{"1,9", http.StatusOK, []string{"1"}, map[string]float64{"9": http.StatusNotFound}},
+		{"1,x", http.StatusBadRequest, nil, nil},
+		{"0", http.StatusBadRequest, nil, nil},
+		{"1,2,3,4", http.StatusBadRequest, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ids, func(t *testing.T) {
+			c, w := testContext(http.MethodGet, "/events/")
+			e.getByIds(c, tt.ids)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Events map[string]struct{ Title string }
+				Errors map[string]struct{ Code float64 }
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Events) != len(tt.found) {
+				t.Errorf("events = %v, want %v", resp.Events, tt.found)
+			}
+			for _, id := range tt.found {
+				if resp.Events[id].Title == "" {
+					t.Errorf("event %s is missing: %s", id, w.Body)
+				}
+			}
+			if len(resp.Errors) != len(tt.errors) {
+				t.Errorf("errors = %v, want %v", resp.Errors, tt.errors)
+			}
+			for id, code := range tt.errors {
+				if resp.Errors[id].Code != code {
+					t.Errorf("errors[%s] = %v, want code %v", id, resp.Errors[id], code)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterMany(t *testing.T) {
+	e := newBulkEvent(t)
+	r := gin.New()
+	r.POST("/events/register", func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		e.RegisterMany(c)
+	})
+
+	tests := []struct {
+		name       string
+		user       string
+		body       string
+		status     int
+		registered string
+		errors     string
+	}{
+		{"all registered", "u1", `{"event_ids":[1,2]}`, http.StatusOK, `[1,2]`, `{}`},
+		{"partial failure", "u1", `{"event_ids":[2,9,1]}`, http.StatusMultiStatus, `[2,1]`, `{"9":{"code":404,"message":"event not found"}}`},
+		{"every registration failed", "full", `{"event_ids":[1,2]}`, http.StatusMultiStatus, `[]`,
+			`{"1":{"code":409,"message":"event is full"},"2":{"code":409,"message":"event is full"}}`},
+		{"empty", "u1", `{"event_ids":[]}`, http.StatusBadRequest, "", ""},
+		{"too many", "u1", `{"event_ids":[1,2,3,4]}`, http.StatusBadRequest, "", ""},
+		{"not json", "u1", `[1,2]`, http.StatusBadRequest, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/events/register", strings.NewReader(tt.body))
+			req.Header.Set("X-User", tt.user)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.registered == "" {
+				return
+			}
+			var resp struct {
+				Registered json.RawMessage
+				Errors     json.RawMessage
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.Registered) != tt.registered || string(resp.Errors) != tt.errors {
+				t.Errorf("registered = %s, errors = %s, want %s and %s", resp.Registered, resp.Errors, tt.registered, tt.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/ical"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// calendarStatus maps an event status to the iCalendar STATUS. Statuses
+// outside eventStatuses have none.
+func calendarStatus(status string) string {
+	switch {
+	case status == "draft":
+		return "TENTATIVE"
+	case status == "cancelled":
+		return "CANCELLED"
+	case slices.Contains(eventStatuses, status):
+		return "CONFIRMED"
+	}
+	return ""
+}
+
+// CreateFeed issues a feed token for the current user and returns the URL of
+// the user's calendar feed, which calendar apps can subscribe to without an
+// Authorization header.
+func (e *Event) CreateFeed(c *gin.Context) {
+	token, err := e.feeds.Issue(c.GetString("user_id"))
+	if err != nil {
+		e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	path := strings.TrimSuffix(c.FullPath(), "/feed") + ".ics"
+
+	e.codec.Render(
+		c,
+		http.StatusCreated,
+		gin.H{
+			"code":    http.StatusCreated,
+			"message": "Successful creating feed token",
+			"token":   token,
+			"url":     fmt.Sprintf("%s://%s%s?token=%s", scheme, c.Request.Host, path, token),
+		},
+	)
+}
+
+// RevokeFeed revokes all feed tokens issued to the current user.
+func (e *Event) RevokeFeed(c *gin.Context) {
+	if err := e.feeds.Revoke(c.GetString("user_id")); err != nil {
+		e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	e.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":    http.StatusOK,
+			"message": "Successful revoking feed tokens",
+		},
+	)
+}
+
+// GetAllByUserCalendar returns the events the current user is registered for
+// as an iCalendar feed.
+func (e *Event) GetAllByUserCalendar(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
+	defer cancel()
+
+	req := &pb.GetAllByUserRequest{
+		UserId: c.GetString("user_id"),
+	}
+	resp, err := e.eventClient.GetAllByUser(ctx, req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
+			return
+		}
+		st, _ := status.FromError(err)
+		code := st.Code()
+		switch code {
+		case codes.InvalidArgument:
+			e.abortWithError(c, http.StatusBadRequest, st.Message())
+		case codes.Internal:
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
+		}
+		return
+	}
+
+	events := make([]ical.Event, 0, len(resp.Events))
+	for _, event := range resp.Events {
+		events = append(events, e.calendarEvent(event))
+	}
+	e.renderCalendar(c, "events.ics", "EventHub", events)
+}
+
+// GetByIdCalendar returns a single event as an iCalendar file.
+func (e *Event) GetByIdCalendar(c *gin.Context) {
+	id, ok := e.pathID(c)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
+	defer cancel()
+
+	req := &pb.GetByIdRequest{Id: int64(id)}
+	event, err := e.eventClient.GetById(ctx, req)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
+			return
+		}
+		st, _ := status.FromError(err)
+		code := st.Code()
+		switch code {
+		case codes.NotFound:
+			e.abortWithError(c, http.StatusNotFound, "Not found")
+		case codes.Internal:
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
+		}
+		return
+	}
+
+	e.renderCalendar(c, fmt.Sprintf("event-%d.ics", id), event.Title, []ical.Event{e.calendarEvent(&pb.EventElem{
+		Id:        event.Id,
+		Title:     event.Title,
+		About:     event.About,
+		StartDate: event.StartDate,
+		Location:  event.Location,
+		Status:    event.Status,
+	})})
+}
+
+func (e *Event) calendarEvent(event *pb.EventElem) ical.Event {
+	var start time.Time
+	if event.StartDate != nil {
+		start = event.StartDate.AsTime()
+	}
+	return ical.Event{
+		UID:         fmt.Sprintf("event-%d@%s", event.Id, e.config.Calendar.UIDDomain),
+		Summary:     event.Title,
+		Description: event.About,
+		Location:    event.Location,
+		Status:      calendarStatus(event.Status),
+		Start:       start,
+	}
+}
+
+func (e *Event) renderCalendar(c *gin.Context, filename, name string, events []ical.Event) {
+	c.Header("Content-Type", ical.MIMECalendar+"; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	c.Header("Cache-Control", "private, no-cache")
+	c.Status(http.StatusOK)
+
+	w := ical.NewWriter(c.Writer, e.config.Calendar.ProdID, name)
+	for _, event := range events {
+		if err := w.WriteEvent(event); err != nil {
+			e.logger.Warn("Writing calendar failed", slog.String("error", err.Error()))
+			return
+		}
+	}
+	if err := w.Close(); err != nil {
+		e.logger.Warn("Writing calendar failed", slog.String("error", err.Error()))
+	}
+}
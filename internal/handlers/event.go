@@ -2,233 +2,269 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"strconv"
 
+	"github.com/Estriper0/eventhub_gateway/internal/aggregate"
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
+	"github.com/Estriper0/eventhub_gateway/internal/coalesce"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
 	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/etag"
+	"github.com/Estriper0/eventhub_gateway/internal/feed"
+	"github.com/Estriper0/eventhub_gateway/internal/watch"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	"github.com/Estriper0/eventhub_gateway/internal/ws"
+	authpb "github.com/Estriper0/protobuf/gen/auth"
 	pb "github.com/Estriper0/protobuf/gen/event"
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// ErrInvalidStatus is returned for statuses outside eventStatuses.
+var ErrInvalidStatus = errors.New("status is invalid")
+
+// eventStatuses are the values of the EventStatus enum of the OpenAPI spec.
+var eventStatuses = []string{"draft", "open", "closed", "cancelled", "completed"}
+
 type Event struct {
 	logger      *slog.Logger
 	config      *config.Config
+	codec       *codec.Codec
+	feeds       *feed.Signer
+	hub         *watch.Hub
+	streams     *watch.Limiter
+	sockets     *ws.Manager
+	socketLimit *watch.Limiter
+	webhooks    *webhook.Dispatcher
+	aggregator  *aggregate.Aggregator
+	cache       cache.Backend
 	eventClient pb.EventClient
 }
 
-func NewEvent(logger *slog.Logger, config *config.Config) *Event {
-	conn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Event.Host, config.Event.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+func NewEvent(logger *slog.Logger, config *config.Config, feeds *feed.Signer, hub *watch.Hub, sockets *ws.Manager, webhooks *webhook.Dispatcher, responseCache cache.Backend) *Event {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	if config.Coalescing.Enabled {
+		coalescer := coalesce.New(config.Coalescing.Methods, config.Timeout)
+		opts = append(opts, grpc.WithUnaryInterceptor(coalescer.UnaryClientInterceptor()))
+	}
+
+	conn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Event.Host, config.Event.Port), opts...)
+	if err != nil {
+		panic(err)
+	}
+	authConn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Auth.Host, config.Auth.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
 	if err != nil {
 		panic(err)
 	}
+	eventClient := pb.NewEventClient(conn)
 
 	return &Event{
 		logger:      logger,
 		config:      config,
-		eventClient: pb.NewEventClient(conn),
+		codec:       codec.New(config.Protojson),
+		feeds:       feeds,
+		hub:         hub,
+		streams:     watch.NewLimiter(config.Stream.MaxPerUser),
+		sockets:     sockets,
+		socketLimit: watch.NewLimiter(config.WebSocket.MaxPerUser),
+		webhooks:    webhooks,
+		aggregator:  aggregate.New(config.Expand, authpb.NewAuthClient(authConn), eventClient),
+		cache:       responseCache,
+		eventClient: eventClient,
 	}
 }
 
 func (e *Event) GetAll(c *gin.Context) {
+	if raw, ok := c.GetQuery("ids"); ok {
+		e.getByIds(c, raw)
+		return
+	}
+
+	query, err := parseListQuery(c, e.config.Pagination, e.config.Export)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "events")
+		return
+	}
+
 	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, query.metadata()...)
 
+	var header metadata.MD
 	req := &pb.EmptyRequest{}
-	resp, err := e.eventClient.GetAll(ctx, req)
+	resp, err := e.eventClient.GetAll(ctx, req, grpc.Header(&header))
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "events")
 			return
 		}
-		c.JSON(
-			http.StatusInternalServerError,
-			gin.H{
-				"code":    http.StatusInternalServerError,
-				"message": "Internal server error",
-				"events":  nil,
-			},
-		)
+		e.abortWithError(c, http.StatusInternalServerError, "Internal server error", "events")
+		return
+	}
+
+	events, total := query.page(resp.Events, header)
+	if query.export != nil {
+		writeRows(c, query.export, "events", events, eventColumns)
 		return
 	}
+	query.setHeaders(c, total)
 
-	c.JSON(
+	e.codec.RenderMessage(
+		c,
 		http.StatusOK,
-		gin.H{
+		e.withExpand(ctx, c, query.expand, events, gin.H{
 			"code":    http.StatusOK,
 			"message": "Successful getting all events",
-			"events":  resp.Events,
-		},
+			"events":  events,
+		}),
+		&pb.GetAllResponse{Events: events},
 	)
 }
 
 func (e *Event) GetAllByCreator(c *gin.Context) {
 	creator, ok := c.Params.Get("creator")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "Creator field is missing",
-				"events":  nil,
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "Creator field is missing", "events")
+		return
+	}
+
+	query, err := parseListQuery(c, e.config.Pagination, e.config.Export)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "events")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, query.metadata()...)
 
+	var header metadata.MD
 	req := &pb.GetAllByCreatorRequest{Creator: creator}
-	resp, err := e.eventClient.GetAllByCreator(ctx, req)
+	resp, err := e.eventClient.GetAllByCreator(ctx, req, grpc.Header(&header))
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "events")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message(), "events")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error", "events")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error", "events")
 		}
 		return
 	}
 
-	c.JSON(
+	events, total := query.page(resp.Events, header)
+	if query.export != nil {
+		writeRows(c, query.export, "events-creator-"+creator, events, eventColumns)
+		return
+	}
+	query.setHeaders(c, total)
+
+	e.codec.RenderMessage(
+		c,
 		http.StatusOK,
-		gin.H{
+		e.withExpand(ctx, c, query.expand, events, gin.H{
 			"code":    http.StatusOK,
 			"message": "Successful getting all events",
-			"events":  resp.Events,
-		},
+			"events":  events,
+		}),
+		&pb.GetAllResponse{Events: events},
 	)
 }
 
 func (e *Event) GetAllByStatus(c *gin.Context) {
 	sts, ok := c.Params.Get("status")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "Creator field is missing",
-				"events":  nil,
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "Status field is missing", "events")
+		return
+	}
+
+	if !slices.Contains(eventStatuses, sts) {
+		e.abortWithError(c, http.StatusBadRequest, ErrInvalidStatus.Error(), "events")
+		return
+	}
+
+	query, err := parseListQuery(c, e.config.Pagination, e.config.Export)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "events")
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, query.metadata()...)
 
+	var header metadata.MD
 	req := &pb.GetAllByStatusRequest{Status: sts}
-	resp, err := e.eventClient.GetAllByStatus(ctx, req)
+	resp, err := e.eventClient.GetAllByStatus(ctx, req, grpc.Header(&header))
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "events")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message(), "events")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error", "events")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error", "events")
 		}
 		return
 	}
 
-	c.JSON(
+	events, total := query.page(resp.Events, header)
+	if query.export != nil {
+		writeRows(c, query.export, "events-"+sts, events, eventColumns)
+		return
+	}
+	query.setHeaders(c, total)
+
+	e.codec.RenderMessage(
+		c,
 		http.StatusOK,
-		gin.H{
+		e.withExpand(ctx, c, query.expand, events, gin.H{
 			"code":    http.StatusOK,
 			"message": "Successful getting all events",
-			"events":  resp.Events,
-		},
+			"events":  events,
+		}),
+		&pb.GetAllResponse{Events: events},
 	)
 }
 
 func (e *Event) GetById(c *gin.Context) {
 	idStr, ok := c.Params.Get("id")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID field is missing",
-				"event":   nil,
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID field is missing", "event")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID is not a number",
-				"event":   nil,
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID is not a number", "event")
+		return
+	}
+
+	expand, err := parseExpand(c, eventExpansions...)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "event")
 		return
 	}
 
@@ -239,47 +275,43 @@ func (e *Event) GetById(c *gin.Context) {
 	event, err := e.eventClient.GetById(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-					"event":   nil,
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "event")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.NotFound:
-			c.JSON(
-				http.StatusNotFound,
-				gin.H{
-					"code":    http.StatusNotFound,
-					"message": "Not found",
-					"event":   nil,
-				},
-			)
+			e.abortWithError(c, http.StatusNotFound, "Not found", "event")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-					"event":   nil,
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error", "event")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error", "event")
 		}
 		return
 	}
-	c.JSON(
+
+	// Expanded responses embed other resources, which the tag of the event
+	// doesn't cover, so they aren't tagged.
+	if len(expand) == 0 {
+		if tag, err := etag.FromMessage(event, codec.Negotiate(c.GetHeader("Accept"))); err == nil {
+			c.Header("ETag", tag)
+			if etag.Match(c.GetHeader("If-None-Match"), tag, true) {
+				c.Status(http.StatusNotModified)
+				return
+			}
+		}
+	}
+
+	e.codec.RenderMessage(
+		c,
 		http.StatusOK,
-		gin.H{
+		e.withExpand(ctx, c, expand, []*pb.EventElem{eventElem(event)}, gin.H{
 			"code":    http.StatusOK,
 			"message": "Successful getting event",
 			"event":   event,
-		},
+		}),
+		event,
 	)
 }
 
@@ -289,15 +321,9 @@ func (e *Event) Create(c *gin.Context) {
 
 	var req pb.CreateRequest
 
-	err := c.ShouldBindJSON(&req)
+	err := e.codec.Bind(c, &req)
 	if err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "JSON is incorrect",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "JSON is incorrect")
 		return
 	}
 	req.Creator = c.GetString("user_id")
@@ -305,67 +331,43 @@ func (e *Event) Create(c *gin.Context) {
 	resp, err := e.eventClient.Create(ctx, &req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message())
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
 		}
 		return
 	}
-	c.JSON(
+	e.publish(webhook.EventCreated, gin.H{"event_id": resp.Id, "event": &req})
+
+	e.codec.RenderMessage(
+		c,
 		http.StatusCreated,
 		gin.H{
 			"code":    http.StatusCreated,
 			"message": fmt.Sprintf("Event with ID=%d was created", resp.Id),
 		},
+		resp,
 	)
 }
 
 func (e *Event) DeleteById(c *gin.Context) {
 	idStr, ok := c.Params.Get("id")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID field is missing",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID field is missing")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID is not a number",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID is not a number")
 		return
 	}
 
@@ -380,38 +382,26 @@ func (e *Event) DeleteById(c *gin.Context) {
 	_, err = e.eventClient.DeleteById(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.NotFound:
-			c.JSON(
-				http.StatusNotFound,
-				gin.H{
-					"code":    http.StatusNotFound,
-					"message": "Not found",
-				},
-			)
+			e.abortWithError(c, http.StatusNotFound, "Not found")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
 		}
 		return
 	}
-	c.JSON(
+	e.aggregator.Forget(int64(id))
+	e.publish(webhook.EventDeleted, gin.H{"event_id": id})
+
+	e.codec.Render(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":    http.StatusOK,
@@ -422,14 +412,8 @@ func (e *Event) DeleteById(c *gin.Context) {
 
 func (e *Event) Update(c *gin.Context) {
 	var req pb.UpdateRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "JSON is incorrect",
-			},
-		)
+	if err := e.codec.Bind(c, &req); err != nil {
+		e.abortWithError(c, http.StatusBadRequest, "JSON is incorrect")
 		return
 	}
 	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
@@ -439,49 +423,120 @@ func (e *Event) Update(c *gin.Context) {
 		return
 	}
 
-	_, err := e.eventClient.Update(ctx, &req)
+	e.update(ctx, c, &req)
+}
+
+func (e *Event) UpdateById(c *gin.Context) {
+	id, ok := e.pathID(c)
+	if !ok {
+		return
+	}
+
+	var req pb.UpdateRequest
+	if err := e.codec.Bind(c, &req); err != nil {
+		e.abortWithError(c, http.StatusBadRequest, "JSON is incorrect")
+		return
+	}
+	if req.Id != 0 && req.Id != int64(id) {
+		e.abortWithError(c, http.StatusBadRequest, "ID in the body does not match the path")
+		return
+	}
+	req.Id = int64(id)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
+	defer cancel()
+
+	if !e.UserVerification(ctx, c, id) {
+		return
+	}
+
+	e.update(ctx, c, &req)
+}
+
+// Patch applies a JSON Merge Patch or JSON Patch body on top of the current
+// state of the event and stores the result with a full update.
+func (e *Event) Patch(c *gin.Context) {
+	id, ok := e.pathID(c)
+	if !ok {
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil || len(body) == 0 {
+		e.abortWithError(c, http.StatusBadRequest, "JSON is incorrect")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
+	defer cancel()
+
+	current, ok := e.ownedEvent(ctx, c, id)
+	if !ok {
+		return
+	}
+
+	doc, err := e.codec.Document(&pb.UpdateRequest{
+		Id:           current.Id,
+		Title:        current.Title,
+		About:        current.About,
+		StartDate:    current.StartDate,
+		Location:     current.Location,
+		Status:       current.Status,
+		MaxAttendees: current.MaxAttendees,
+	})
+	if err != nil {
+		e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		return
+	}
+
+	patched, err := applyPatch(c.ContentType(), doc, body)
+	if err != nil {
+		if errors.Is(err, ErrUnsupportedPatch) {
+			e.abortWithError(c, http.StatusUnsupportedMediaType, fmt.Sprintf("Content-Type must be %s or %s", MIMEMergePatch, MIMEJSONPatch))
+			return
+		}
+		e.abortWithError(c, http.StatusBadRequest, fmt.Sprintf("Patch can't be applied: %s", err))
+		return
+	}
+
+	var req pb.UpdateRequest
+	if err := e.codec.Unmarshal(patched, &req); err != nil {
+		e.abortWithError(c, http.StatusBadRequest, "Patched event is incorrect")
+		return
+	}
+	if req.Id != int64(id) {
+		e.abortWithError(c, http.StatusBadRequest, "ID can't be changed")
+		return
+	}
+
+	e.update(ctx, c, &req)
+}
+
+func (e *Event) update(ctx context.Context, c *gin.Context, req *pb.UpdateRequest) {
+	_, err := e.eventClient.Update(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.NotFound:
-			c.JSON(
-				http.StatusNotFound,
-				gin.H{
-					"code":    http.StatusNotFound,
-					"message": "Not found",
-				},
-			)
+			e.abortWithError(c, http.StatusNotFound, "Not found")
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message())
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
 		}
 		return
 	}
-	c.JSON(
+	e.publish(webhook.EventUpdated, gin.H{"event_id": req.Id, "event": req})
+
+	e.codec.Render(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":    http.StatusOK,
@@ -491,82 +546,68 @@ func (e *Event) Update(c *gin.Context) {
 }
 
 func (e *Event) GetAllByUser(c *gin.Context) {
+	query, err := parseListQuery(c, e.config.Pagination, e.config.Export)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "events")
+		return
+	}
+
 	req := &pb.GetAllByUserRequest{
 		UserId: c.GetString("user_id"),
 	}
 
 	ctx, cancel := context.WithTimeout(c.Request.Context(), e.config.Timeout)
 	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, query.metadata()...)
 
-	resp, err := e.eventClient.GetAllByUser(ctx, req)
+	var header metadata.MD
+	resp, err := e.eventClient.GetAllByUser(ctx, req, grpc.Header(&header))
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "events")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message(), "events")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-					"events":  nil,
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error", "events")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error", "events")
 		}
 		return
 	}
 
-	c.JSON(
+	events, total := query.page(resp.Events, header)
+	if query.export != nil {
+		writeRows(c, query.export, "my-events", events, eventColumns)
+		return
+	}
+	query.setHeaders(c, total)
+
+	e.codec.RenderMessage(
+		c,
 		http.StatusOK,
-		gin.H{
+		e.withExpand(ctx, c, query.expand, events, gin.H{
 			"code":    http.StatusOK,
 			"message": "Successful getting all events by user",
-			"events":  resp.Events,
-		},
+			"events":  events,
+		}),
+		&pb.GetAllByUserResponse{Events: events},
 	)
 }
 
 func (e *Event) GetAllUsersByEvent(c *gin.Context) {
 	idStr, ok := c.Params.Get("id")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID field is missing",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID field is missing")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID is not a number",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID is not a number")
 		return
 	}
 	req := &pb.GetAllUsersByEventRequest{
@@ -575,14 +616,19 @@ func (e *Event) GetAllUsersByEvent(c *gin.Context) {
 
 	is_admin := c.GetBool("is_admin")
 	if !is_admin {
-		c.JSON(
-			http.StatusForbidden,
-			gin.H{
-				"code":     http.StatusForbidden,
-				"message":  "The user does not have access to the requested resource.",
-				"users_id": nil,
-			},
-		)
+		e.abortWithError(c, http.StatusForbidden, "The user does not have access to the requested resource.", "users_id")
+		return
+	}
+
+	export, err := parseExport(c, userColumns, e.config.Export.UserColumns, e.config.Export.FlushRows)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "users_id")
+		return
+	}
+
+	expand, err := parseExpand(c, aggregate.Users)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, err.Error(), "users_id")
 		return
 	}
 
@@ -592,72 +638,53 @@ func (e *Event) GetAllUsersByEvent(c *gin.Context) {
 	resp, err := e.eventClient.GetAllUsersByEvent(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":     http.StatusGatewayTimeout,
-					"message":  "Request timed out",
-					"users_id": nil,
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "users_id")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":     http.StatusBadRequest,
-					"message":  err.Error(),
-					"users_id": nil,
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message(), "users_id")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":     http.StatusInternalServerError,
-					"message":  "Internal error",
-					"users_id": nil,
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error", "users_id")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error", "users_id")
 		}
 		return
 	}
 
-	c.JSON(
+	if export != nil {
+		writeRows(c, export, fmt.Sprintf("event-%d-users", id), resp.UsersId, userColumns)
+		return
+	}
+
+	data := gin.H{
+		"code":     http.StatusOK,
+		"message":  "Successful getting all users_id by event",
+		"users_id": resp.UsersId,
+	}
+	if len(expand) > 0 {
+		data = withResult(data, e.aggregator.Users(ctx, resp.UsersId))
+	}
+
+	e.codec.RenderMessage(
+		c,
 		http.StatusOK,
-		gin.H{
-			"code":     http.StatusOK,
-			"message":  "Successful getting all users_id by event",
-			"users_id": resp.UsersId,
-		},
+		data,
+		resp,
 	)
 }
 
 func (e *Event) Register(c *gin.Context) {
 	idStr, ok := c.Params.Get("id")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID field is missing",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID field is missing")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID is not a number",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID is not a number")
 		return
 	}
 	req := &pb.RegisterRequest{
@@ -671,63 +698,33 @@ func (e *Event) Register(c *gin.Context) {
 	_, err = e.eventClient.Register(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message())
 		case codes.ResourceExhausted:
-			c.JSON(
-				http.StatusConflict,
-				gin.H{
-					"code":    http.StatusConflict,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusConflict, st.Message())
 		case codes.AlreadyExists:
-			c.JSON(
-				http.StatusConflict,
-				gin.H{
-					"code":    http.StatusConflict,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusConflict, st.Message())
 		case codes.NotFound:
-			c.JSON(
-				http.StatusNotFound,
-				gin.H{
-					"code":    http.StatusNotFound,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusNotFound, st.Message())
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
 		}
 		return
 	}
 
-	c.JSON(
+	e.aggregator.Forget(req.EventId)
+	e.publish(webhook.RegistrationCreated, gin.H{"event_id": req.EventId, "user_id": req.UserId})
+
+	e.codec.Render(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":    http.StatusOK,
@@ -740,24 +737,12 @@ func (e *Event) Register(c *gin.Context) {
 func (e *Event) CancellRegister(c *gin.Context) {
 	idStr, ok := c.Params.Get("id")
 	if !ok {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID field is missing",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID field is missing")
 		return
 	}
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		c.JSON(
-			http.StatusBadRequest,
-			gin.H{
-				"code":    http.StatusBadRequest,
-				"message": "ID is not a number",
-			},
-		)
+		e.abortWithError(c, http.StatusBadRequest, "ID is not a number")
 		return
 	}
 	req := &pb.CancellRegisterRequest{
@@ -771,47 +756,29 @@ func (e *Event) CancellRegister(c *gin.Context) {
 	_, err = e.eventClient.CancellRegister(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-				},
-			)
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out")
 			return
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.InvalidArgument:
-			c.JSON(
-				http.StatusBadRequest,
-				gin.H{
-					"code":    http.StatusBadRequest,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusBadRequest, st.Message())
 		case codes.NotFound:
-			c.JSON(
-				http.StatusNotFound,
-				gin.H{
-					"code":    http.StatusNotFound,
-					"message": err.Error(),
-				},
-			)
+			e.abortWithError(c, http.StatusNotFound, st.Message())
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error")
 		}
 		return
 	}
 
-	c.JSON(
+	e.aggregator.Forget(req.EventId)
+	e.publish(webhook.RegistrationCancelled, gin.H{"event_id": req.EventId, "user_id": req.UserId})
+
+	e.codec.Render(
+		c,
 		http.StatusOK,
 		gin.H{
 			"code":    http.StatusOK,
@@ -822,54 +789,84 @@ func (e *Event) CancellRegister(c *gin.Context) {
 }
 
 func (e *Event) UserVerification(ctx context.Context, c *gin.Context, id int) bool {
+	_, ok := e.ownedEvent(ctx, c, id)
+	return ok
+}
+
+// ownedEvent fetches the event, checks that the current user created it and
+// that it still matches the If-Match header, if any. On failure the error
+// response is already written.
+func (e *Event) ownedEvent(ctx context.Context, c *gin.Context, id int) (*pb.GetByIdResponse, bool) {
 	req := &pb.GetByIdRequest{Id: int64(id)}
 	resp, err := e.eventClient.GetById(ctx, req)
 	if err != nil {
 		if ctx.Err() == context.DeadlineExceeded {
-			c.JSON(
-				http.StatusGatewayTimeout,
-				gin.H{
-					"code":    http.StatusGatewayTimeout,
-					"message": "Request timed out",
-					"event":   nil,
-				},
-			)
-			return false
+			e.abortWithError(c, http.StatusGatewayTimeout, "Request timed out", "event")
+			return nil, false
 		}
 		st, _ := status.FromError(err)
 		code := st.Code()
 		switch code {
 		case codes.NotFound:
-			c.JSON(
-				http.StatusNotFound,
-				gin.H{
-					"code":    http.StatusNotFound,
-					"message": "Not found",
-					"event":   nil,
-				},
-			)
+			e.abortWithError(c, http.StatusNotFound, "Not found", "event")
 		case codes.Internal:
-			c.JSON(
-				http.StatusInternalServerError,
-				gin.H{
-					"code":    http.StatusInternalServerError,
-					"message": "Internal error",
-					"event":   nil,
-				},
-			)
+			e.abortWithError(c, http.StatusInternalServerError, "Internal error", "event")
+		default:
+			e.abortWithError(c, http.StatusBadGateway, "Upstream service error", "event")
 		}
-		return false
+		return nil, false
 	}
 	if resp.Creator != c.GetString("user_id") {
-		c.JSON(
-			http.StatusForbidden,
-			gin.H{
-				"code":    http.StatusForbidden,
-				"message": "The user does not have access to the requested resource.",
-				"event":   nil,
-			},
-		)
-		return false
-	}
-	return true
+		e.abortWithError(c, http.StatusForbidden, "The user does not have access to the requested resource.", "event")
+		return nil, false
+	}
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		// The tag is compared with the one of the representation the
+		// request asks for, as a client reads and writes the same format.
+		tag, err := etag.FromMessage(resp, codec.Negotiate(c.GetHeader("Accept")))
+		if err != nil || !etag.Match(ifMatch, tag, false) {
+			e.abortWithError(c, http.StatusPreconditionFailed, "The event has been changed since it was read", "event")
+			return nil, false
+		}
+	}
+	return resp, true
+}
+
+// abortWithError renders an error response and aborts the request. The keys
+// are rendered as null, so that errors keep the shape of the successful
+// response of the handler.
+func (e *Event) abortWithError(c *gin.Context, code int, message string, keys ...string) {
+	obj := gin.H{
+		"code":    code,
+		"message": message,
+	}
+	for _, key := range keys {
+		obj[key] = nil
+	}
+	e.codec.Render(c, code, obj)
+	c.Abort()
+}
+
+// publish notifies webhook subscribers about a successful change.
+func (e *Event) publish(event string, data gin.H) {
+	payload, err := e.codec.Marshal(data)
+	if err != nil {
+		e.logger.Error("Encoding webhook data failed", slog.String("error", err.Error()))
+		return
+	}
+	e.webhooks.Publish(event, payload)
+}
+
+func (e *Event) pathID(c *gin.Context) (int, bool) {
+	idStr, ok := c.Params.Get("id")
+	if !ok {
+		e.abortWithError(c, http.StatusBadRequest, "ID field is missing")
+		return 0, false
+	}
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		e.abortWithError(c, http.StatusBadRequest, "ID is not a number")
+		return 0, false
+	}
+	return id, true
 }
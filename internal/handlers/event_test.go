@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/api"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestGetByIdErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{status.Error(codes.NotFound, "event not found"), http.StatusNotFound},
+		{status.Error(codes.Internal, "db is down"), http.StatusInternalServerError},
+		{status.Error(codes.Unavailable, "connection refused"), http.StatusBadGateway},
+		{status.Error(codes.PermissionDenied, "denied"), http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(status.Code(tt.err).String(), func(t *testing.T) {
+			e := &Event{
+				logger:      slog.New(slog.NewTextHandler(io.Discard, nil)),
+				config:      &config.Config{Timeout: time.Second},
+				codec:       codec.New(config.Protojson{}),
+				eventClient: &fakeEventClient{events: map[int64]*pb.GetByIdResponse{}, err: tt.err},
+			}
+			r := gin.New()
+			r.GET("/events/:id", e.GetById)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events/1", nil))
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("body %q: %v", w.Body, err)
+			}
+			if body["code"] != float64(tt.status) {
+				t.Errorf("body = %v", body)
+			}
+		})
+	}
+}
+
+func TestEventStatuses(t *testing.T) {
+	spec, err := api.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var enum []string
+	for _, v := range spec.Components.Schemas["EventStatus"].Value.Enum {
+		enum = append(enum, v.(string))
+	}
+	if !slices.Equal(enum, eventStatuses) {
+		t.Errorf("EventStatus enum = %v, want %v", enum, eventStatuses)
+	}
+
+	for _, s := range eventStatuses {
+		if calendarStatus(s) == "" {
+			t.Errorf("status %q has no calendar status", s)
+		}
+	}
+	if got := calendarStatus("archived"); got != "" {
+		t.Errorf("calendarStatus(archived) = %q, want none", got)
+	}
+}
+
+func TestGetAllByStatusRejectsUnknownStatus(t *testing.T) {
+	e := &Event{
+		config: &config.Config{Timeout: time.Second},
+		codec:  codec.New(config.Protojson{}),
+	}
+	r := gin.New()
+	r.GET("/events/status/:status", e.GetAllByStatus)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events/status/archived", nil))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
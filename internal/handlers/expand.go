@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"context"
+
+	"github.com/Estriper0/eventhub_gateway/internal/aggregate"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+)
+
+// eventExpansions are the ?expand= values accepted by the event endpoints.
+var eventExpansions = []string{aggregate.Creator, aggregate.Attendees}
+
+func parseExpand(c *gin.Context, allowed ...string) ([]string, error) {
+	raw := c.Query("expand")
+	if raw == "" {
+		return nil, nil
+	}
+	return aggregate.Parse(raw, allowed...)
+}
+
+// withExpand adds the entities joined for the events to body under "expanded"
+// and the ones that could not be joined under "expand_errors". Attendees are
+// only shown to admins, like GET /events/:id/users.
+func (e *Event) withExpand(ctx context.Context, c *gin.Context, fields []string, events []*pb.EventElem, body gin.H) gin.H {
+	if len(fields) == 0 {
+		return body
+	}
+	refs := make([]aggregate.Ref, len(events))
+	for i, event := range events {
+		refs[i] = aggregate.Ref{ID: event.Id, Creator: event.Creator}
+	}
+	return withResult(body, e.aggregator.Events(ctx, fields, refs, c.GetBool("is_admin")))
+}
+
+func withResult(body gin.H, result *aggregate.Result) gin.H {
+	body["expanded"] = result
+	if len(result.Failures) > 0 {
+		body["expand_errors"] = result.Failures
+	}
+	return body
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	formatCSV    = "csv"
+	formatNDJSON = "ndjson"
+
+	MIMECSV    = "text/csv"
+	MIMENDJSON = "application/x-ndjson"
+)
+
+var (
+	ErrInvalidFormat  = errors.New("format is invalid")
+	ErrInvalidColumns = errors.New("columns are invalid")
+)
+
+var eventColumns = map[string]func(e *pb.EventElem) any{
+	"id":       func(e *pb.EventElem) any { return e.Id },
+	"title":    func(e *pb.EventElem) any { return e.Title },
+	"about":    func(e *pb.EventElem) any { return e.About },
+	"location": func(e *pb.EventElem) any { return e.Location },
+	"status":   func(e *pb.EventElem) any { return e.Status },
+	"creator":  func(e *pb.EventElem) any { return e.Creator },
+	"start_date": func(e *pb.EventElem) any {
+		if e.StartDate == nil {
+			return nil
+		}
+		return e.StartDate.AsTime()
+	},
+	"max_attendees":      func(e *pb.EventElem) any { return e.MaxAttendees },
+	"current_attendance": func(e *pb.EventElem) any { return e.CurrentAttendance },
+}
+
+var userColumns = map[string]func(userID string) any{
+	"user_id": func(userID string) any { return userID },
+}
+
+// export describes a CSV or NDJSON export requested with ?format= and
+// ?columns= on a list endpoint.
+type export struct {
+	format  string
+	columns []string
+	flush   int
+}
+
+// parseExport returns nil if the client asked for the regular JSON response.
+func parseExport[T any](c *gin.Context, available map[string]func(T) any, defaults []string, flush int) (*export, error) {
+	format := c.Query("format")
+	switch format {
+	case "", "json":
+		return nil, nil
+	case formatCSV, formatNDJSON:
+	default:
+		return nil, ErrInvalidFormat
+	}
+
+	columns := slices.Clone(defaults)
+	if v := c.Query("columns"); v != "" {
+		columns = strings.Split(v, ",")
+	}
+	if len(columns) == 0 {
+		return nil, ErrInvalidColumns
+	}
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+		if _, ok := available[columns[i]]; !ok {
+			return nil, fmt.Errorf("%w: unknown column %q", ErrInvalidColumns, columns[i])
+		}
+	}
+
+	return &export{format: format, columns: columns, flush: max(flush, 1)}, nil
+}
+
+// writeRows streams rows to the client, flushing every x.flush rows, so the
+// export is never held in memory as a whole.
+func writeRows[T any](c *gin.Context, x *export, filename string, rows []T, values map[string]func(T) any) {
+	contentType := MIMECSV + "; charset=utf-8"
+	if x.format == formatNDJSON {
+		contentType = MIMENDJSON
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, x.format))
+	c.Status(http.StatusOK)
+
+	var write func(row T) error
+	var flush func() error
+	switch x.format {
+	case formatCSV:
+		w := csv.NewWriter(c.Writer)
+		record := make([]string, len(x.columns))
+		write = func(row T) error {
+			for i, column := range x.columns {
+				record[i] = csvValue(values[column](row))
+			}
+			return w.Write(record)
+		}
+		flush = func() error {
+			w.Flush()
+			return w.Error()
+		}
+		if err := w.Write(x.columns); err != nil {
+			return
+		}
+	case formatNDJSON:
+		write = func(row T) error {
+			return writeNDJSON(c.Writer, x.columns, func(column string) any { return values[column](row) })
+		}
+		flush = func() error { return nil }
+	}
+
+	for i, row := range rows {
+		if err := write(row); err != nil {
+			return
+		}
+		if (i+1)%x.flush == 0 {
+			if err := flush(); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+	flush()
+}
+
+// csvValue formats a value for a CSV cell. Text cells that spreadsheets would
+// evaluate as formulas are prefixed with a single quote.
+func csvValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+			return "'" + v
+		}
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case int32:
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeNDJSON writes one JSON object with the columns in the given order.
+func writeNDJSON(w io.Writer, columns []string, value func(column string) any) error {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		v := value(column)
+		if t, ok := v.(time.Time); ok {
+			v = t.UTC().Format(time.RFC3339)
+		}
+		val, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestWriteRows(t *testing.T) {
+	events := []*pb.EventElem{
+		{Id: 1, Title: "Go, \"the\" meetup", StartDate: timestamppb.New(time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC))},
+		{Id: 2, Title: "=HYPERLINK(\"x\")"},
+	}
+	columns := []string{"id", "title", "start_date"}
+
+	tests := []struct {
+		format      string
+		contentType string
+		body        string
+	}{
+		{
+			format:      formatCSV,
+			contentType: "text/csv; charset=utf-8",
+			body: "id,title,start_date\n" +
+				"1,\"Go, \"\"the\"\" meetup\",2026-01-01T10:00:00Z\n" +
+				"2,\"'=HYPERLINK(\"\"x\"\")\",\n",
+		},
+		{
+			format:      formatNDJSON,
+			contentType: MIMENDJSON,
+			body: `{"id":1,"title":"Go, \"the\" meetup","start_date":"2026-01-01T10:00:00Z"}` + "\n" +
+				`{"id":2,"title":"=HYPERLINK(\"x\")","start_date":null}` + "\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			c, w := testContext(http.MethodGet, "/events/?format="+tt.format)
+			writeRows(c, &export{format: tt.format, columns: columns, flush: 1}, "events", events, eventColumns)
+
+			if got := w.Header().Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got, want := w.Header().Get("Content-Disposition"), `attachment; filename="events.`+tt.format+`"`; got != want {
+				t.Errorf("Content-Disposition = %q, want %q", got, want)
+			}
+			if w.Body.String() != tt.body {
+				t.Errorf("body =\n%s\nwant\n%s", w.Body, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/Estriper0/eventhub_gateway/internal/aggregate"
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/gql"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var errForbidden = status.Error(codes.PermissionDenied, "The user does not have access to the requested resource.")
+
+type GraphQL struct {
+	logger *slog.Logger
+	config *config.Config
+	codec  *codec.Codec
+	events *Event
+	cache  cache.Backend
+	schema graphql.Schema
+	limits gql.Limits
+}
+
+type graphqlRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables"`
+	OperationName string         `json:"operationName"`
+}
+
+// graphqlSession is the per-request state of the resolvers.
+type graphqlSession struct {
+	userID    string
+	isAdmin   bool
+	users     *gql.Loader[string, aggregate.User]
+	attendees *gql.Loader[int64, []aggregate.User]
+}
+
+type graphqlSessionKey struct{}
+
+// graphqlError is a resolver error with the HTTP status in its extensions.
+type graphqlError struct {
+	code    int
+	message string
+}
+
+func (e *graphqlError) Error() string {
+	return e.message
+}
+
+func (e *graphqlError) Extensions() map[string]any {
+	return map[string]any{"code": e.code}
+}
+
+// NewGraphQL creates the GraphQL handler. Its schema is derived from the
+// event service messages and resolved with the clients of the event handler.
+// Mutations drop the events namespace of responseCache like REST writes do.
+func NewGraphQL(logger *slog.Logger, config *config.Config, events *Event, responseCache cache.Backend) *GraphQL {
+	g := &GraphQL{
+		logger: logger,
+		config: config,
+		codec:  codec.New(config.Protojson),
+		events: events,
+		cache:  responseCache,
+		limits: gql.Limits{
+			MaxDepth:        config.GraphQL.MaxDepth,
+			MaxComplexity:   config.GraphQL.MaxComplexity,
+			Lists:           map[string]string{"events": "limit", "myEvents": "limit", "attendees": ""},
+			DefaultListSize: config.GraphQL.DefaultListSize,
+		},
+	}
+	schema, err := graphql.NewSchema(g.schemaConfig())
+	if err != nil {
+		panic(err)
+	}
+	g.schema = schema
+	return g
+}
+
+// GraphQL executes a query from ?query= (GET, queries only) or a JSON body
+// with query, variables and operationName (POST).
+func (g *GraphQL) GraphQL(c *gin.Context) {
+	var req graphqlRequest
+	if c.Request.Method == http.MethodGet {
+		req.Query = c.Query("query")
+		req.OperationName = c.Query("operationName")
+		if v := c.Query("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				g.fail(c, http.StatusBadRequest, "Variables are incorrect")
+				return
+			}
+		}
+	} else if err := c.ShouldBindJSON(&req); err != nil {
+		g.fail(c, http.StatusBadRequest, "JSON is incorrect")
+		return
+	}
+	if req.Query == "" {
+		g.fail(c, http.StatusBadRequest, "Query is missing")
+		return
+	}
+
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{Body: []byte(req.Query), Name: "GraphQL request"})})
+	if err != nil {
+		g.codec.Render(c, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	if result := graphql.ValidateDocument(&g.schema, doc, nil); !result.IsValid {
+		g.codec.Render(c, http.StatusBadRequest, &graphql.Result{Errors: result.Errors})
+		return
+	}
+	if err := g.limits.Check(doc, req.OperationName, req.Variables); err != nil {
+		g.codec.Render(c, http.StatusBadRequest, &graphql.Result{Errors: gqlerrors.FormatErrors(err)})
+		return
+	}
+	mutation := isMutation(doc, req.OperationName)
+	if mutation && c.Request.Method == http.MethodGet {
+		g.fail(c, http.StatusMethodNotAllowed, "Mutations must be sent with POST")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), g.config.Timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, graphqlSessionKey{}, g.session(ctx, c))
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        g.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	})
+	if mutation {
+		g.cache.DeletePrefix("events:")
+	}
+
+	g.codec.Render(c, http.StatusOK, result)
+}
+
+func (g *GraphQL) fail(c *gin.Context, code int, message string) {
+	g.codec.Render(c, code, &graphql.Result{Errors: []gqlerrors.FormattedError{gqlerrors.NewFormattedError(message)}})
+}
+
+func (g *GraphQL) session(ctx context.Context, c *gin.Context) *graphqlSession {
+	aggregator := g.events.aggregator
+	return &graphqlSession{
+		userID:  c.GetString("user_id"),
+		isAdmin: c.GetBool("is_admin"),
+		users: gql.NewLoader(func(ids []string) (map[string]aggregate.User, map[string]error) {
+			return aggregator.Lookup(ctx, ids)
+		}),
+		attendees: gql.NewLoader(func(ids []int64) (map[int64][]aggregate.User, map[int64]error) {
+			return aggregator.AttendeesOf(ctx, ids)
+		}),
+	}
+}
+
+func isMutation(doc *ast.Document, operationName string) bool {
+	for _, def := range doc.Definitions {
+		if op, ok := def.(*ast.OperationDefinition); ok && (operationName == "" || op.Name != nil && op.Name.Value == operationName) {
+			return op.Operation == ast.OperationTypeMutation
+		}
+	}
+	return false
+}
+
+func (g *GraphQL) schemaConfig() graphql.SchemaConfig {
+	// The auth service only knows the role of a user, see aggregate.User.
+	user := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.ID),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(aggregate.User).ID, nil
+				},
+			},
+			"isAdmin": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(aggregate.User).IsAdmin, nil
+				},
+			},
+		},
+	})
+
+	event := gql.Object("Event", &pb.EventElem{}, graphql.Fields{
+		"creator": &graphql.Field{
+			Type: user,
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				return graphqlThunk(p.Context, sessionOf(p).users.Load(p.Source.(*pb.EventElem).Creator)), nil
+			},
+		},
+		"attendees": &graphql.Field{
+			Type:        graphql.NewList(graphql.NewNonNull(user)),
+			Description: "Only available to admins.",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				session := sessionOf(p)
+				if !session.isAdmin {
+					return nil, graphqlErr(p.Context, errForbidden)
+				}
+				return graphqlThunk(p.Context, session.attendees.Load(p.Source.(*pb.EventElem).Id)), nil
+			},
+		},
+	})
+	events := graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(event)))
+	page := graphql.FieldConfigArgument{
+		"limit":  &graphql.ArgumentConfig{Type: graphql.Int},
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int},
+	}
+	id := &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"events": &graphql.Field{
+				Type: events,
+				Args: graphql.FieldConfigArgument{
+					"status":  &graphql.ArgumentConfig{Type: graphql.String},
+					"creator": &graphql.ArgumentConfig{Type: graphql.String},
+					"search":  &graphql.ArgumentConfig{Type: graphql.String},
+					"limit":   page["limit"],
+					"offset":  page["offset"],
+				},
+				Resolve: g.resolveEvents,
+			},
+			"event": &graphql.Field{
+				Type:    event,
+				Args:    graphql.FieldConfigArgument{"id": id},
+				Resolve: g.resolveEvent,
+			},
+			"myEvents": &graphql.Field{
+				Type:    events,
+				Args:    page,
+				Resolve: g.resolveMyEvents,
+			},
+			"attendees": &graphql.Field{
+				Type:        graphql.NewList(graphql.NewNonNull(user)),
+				Description: "Only available to admins.",
+				Args:        graphql.FieldConfigArgument{"eventId": id},
+				Resolve:     g.resolveAttendees,
+			},
+		},
+	})
+
+	createInput := gql.InputObject("CreateEventInput", &pb.CreateRequest{}, "creator")
+	updateInput := gql.InputObject("UpdateEventInput", &pb.UpdateRequest{}, "id")
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createEvent": &graphql.Field{
+				Type:    event,
+				Args:    graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createInput)}},
+				Resolve: g.createEvent,
+			},
+			"updateEvent": &graphql.Field{
+				Type: event,
+				Args: graphql.FieldConfigArgument{
+					"id":    id,
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(updateInput)},
+				},
+				Resolve: g.updateEvent,
+			},
+			"deleteEvent": &graphql.Field{
+				Type:    graphql.ID,
+				Args:    graphql.FieldConfigArgument{"id": id},
+				Resolve: g.deleteEvent,
+			},
+			"register": &graphql.Field{
+				Type:    graphql.Boolean,
+				Args:    graphql.FieldConfigArgument{"eventId": id},
+				Resolve: g.register,
+			},
+			"cancelRegistration": &graphql.Field{
+				Type:    graphql.Boolean,
+				Args:    graphql.FieldConfigArgument{"eventId": id},
+				Resolve: g.cancelRegistration,
+			},
+		},
+	})
+
+	return graphql.SchemaConfig{Query: query, Mutation: mutation}
+}
+
+func (g *GraphQL) resolveEvents(p graphql.ResolveParams) (any, error) {
+	query := g.listQuery(p)
+	ctx := metadata.AppendToOutgoingContext(p.Context, query.metadata()...)
+
+	var header metadata.MD
+	var resp *pb.GetAllResponse
+	var err error
+	switch {
+	case p.Args["status"] != nil:
+		if !slices.Contains(eventStatuses, p.Args["status"].(string)) {
+			return nil, &graphqlError{code: http.StatusBadRequest, message: ErrInvalidStatus.Error()}
+		}
+		resp, err = g.events.eventClient.GetAllByStatus(ctx, &pb.GetAllByStatusRequest{Status: p.Args["status"].(string)}, grpc.Header(&header))
+	case p.Args["creator"] != nil:
+		resp, err = g.events.eventClient.GetAllByCreator(ctx, &pb.GetAllByCreatorRequest{Creator: p.Args["creator"].(string)}, grpc.Header(&header))
+	default:
+		resp, err = g.events.eventClient.GetAll(ctx, &pb.EmptyRequest{}, grpc.Header(&header))
+	}
+	if err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	events, _ := query.page(resp.Events, header)
+	return events, nil
+}
+
+func (g *GraphQL) resolveMyEvents(p graphql.ResolveParams) (any, error) {
+	query := g.listQuery(p)
+	ctx := metadata.AppendToOutgoingContext(p.Context, query.metadata()...)
+
+	var header metadata.MD
+	resp, err := g.events.eventClient.GetAllByUser(ctx, &pb.GetAllByUserRequest{UserId: sessionOf(p).userID}, grpc.Header(&header))
+	if err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	events, _ := query.page(resp.Events, header)
+	return events, nil
+}
+
+func (g *GraphQL) resolveEvent(p graphql.ResolveParams) (any, error) {
+	id, err := argID(p, "id")
+	if err != nil {
+		return nil, err
+	}
+	event, err := g.events.eventClient.GetById(p.Context, &pb.GetByIdRequest{Id: id})
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	return eventElem(event), nil
+}
+
+func (g *GraphQL) resolveAttendees(p graphql.ResolveParams) (any, error) {
+	id, err := argID(p, "eventId")
+	if err != nil {
+		return nil, err
+	}
+	session := sessionOf(p)
+	if !session.isAdmin {
+		return nil, graphqlErr(p.Context, errForbidden)
+	}
+	return graphqlThunk(p.Context, session.attendees.Load(id)), nil
+}
+
+func (g *GraphQL) createEvent(p graphql.ResolveParams) (any, error) {
+	var req pb.CreateRequest
+	if err := gql.Decode(p.Args["input"], &req); err != nil {
+		return nil, &graphqlError{code: http.StatusBadRequest, message: err.Error()}
+	}
+	req.Creator = sessionOf(p).userID
+
+	resp, err := g.events.eventClient.Create(p.Context, &req)
+	if err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	g.events.publish(webhook.EventCreated, gin.H{"event_id": resp.Id, "event": &req})
+
+	return &pb.EventElem{
+		Id:           resp.Id,
+		Title:        req.Title,
+		About:        req.About,
+		StartDate:    req.StartDate,
+		Location:     req.Location,
+		Status:       req.Status,
+		MaxAttendees: req.MaxAttendees,
+		Creator:      req.Creator,
+	}, nil
+}
+
+func (g *GraphQL) updateEvent(p graphql.ResolveParams) (any, error) {
+	id, err := argID(p, "id")
+	if err != nil {
+		return nil, err
+	}
+	event, err := g.owned(p, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var req pb.UpdateRequest
+	if err := gql.Decode(p.Args["input"], &req); err != nil {
+		return nil, &graphqlError{code: http.StatusBadRequest, message: err.Error()}
+	}
+	req.Id = id
+
+	if _, err := g.events.eventClient.Update(p.Context, &req); err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	g.events.publish(webhook.EventUpdated, gin.H{"event_id": req.Id, "event": &req})
+
+	return &pb.EventElem{
+		Id:                id,
+		Title:             req.Title,
+		About:             req.About,
+		StartDate:         req.StartDate,
+		Location:          req.Location,
+		Status:            req.Status,
+		MaxAttendees:      req.MaxAttendees,
+		CurrentAttendance: event.CurrentAttendance,
+		Creator:           event.Creator,
+	}, nil
+}
+
+func (g *GraphQL) deleteEvent(p graphql.ResolveParams) (any, error) {
+	id, err := argID(p, "id")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := g.owned(p, id); err != nil {
+		return nil, err
+	}
+
+	if _, err := g.events.eventClient.DeleteById(p.Context, &pb.DeleteByIdRequest{Id: id}); err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	g.events.aggregator.Forget(id)
+	g.events.publish(webhook.EventDeleted, gin.H{"event_id": id})
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+func (g *GraphQL) register(p graphql.ResolveParams) (any, error) {
+	id, err := argID(p, "eventId")
+	if err != nil {
+		return nil, err
+	}
+	userID := sessionOf(p).userID
+
+	if _, err := g.events.eventClient.Register(p.Context, &pb.RegisterRequest{UserId: userID, EventId: id}); err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	g.events.aggregator.Forget(id)
+	g.events.publish(webhook.RegistrationCreated, gin.H{"event_id": id, "user_id": userID})
+
+	return true, nil
+}
+
+func (g *GraphQL) cancelRegistration(p graphql.ResolveParams) (any, error) {
+	id, err := argID(p, "eventId")
+	if err != nil {
+		return nil, err
+	}
+	userID := sessionOf(p).userID
+
+	if _, err := g.events.eventClient.CancellRegister(p.Context, &pb.CancellRegisterRequest{UserId: userID, EventId: id}); err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	g.events.aggregator.Forget(id)
+	g.events.publish(webhook.RegistrationCancelled, gin.H{"event_id": id, "user_id": userID})
+
+	return true, nil
+}
+
+// owned fetches the event and checks that the current user created it.
+func (g *GraphQL) owned(p graphql.ResolveParams, id int64) (*pb.GetByIdResponse, error) {
+	event, err := g.events.eventClient.GetById(p.Context, &pb.GetByIdRequest{Id: id})
+	if err != nil {
+		return nil, graphqlErr(p.Context, err)
+	}
+	if event.Creator != sessionOf(p).userID {
+		return nil, graphqlErr(p.Context, errForbidden)
+	}
+	return event, nil
+}
+
+func (g *GraphQL) listQuery(p graphql.ResolveParams) *listQuery {
+	query := &listQuery{paged: true, limit: g.config.Pagination.DefaultLimit}
+	if limit, ok := p.Args["limit"].(int); ok && limit > 0 {
+		query.limit = limit
+	}
+	query.limit = clampLimit(query.limit, g.config.Pagination)
+	if offset, ok := p.Args["offset"].(int); ok && offset > 0 {
+		query.offset = offset
+	}
+	if search, ok := p.Args["search"].(string); ok {
+		query.search = search
+	}
+	return query
+}
+
+func sessionOf(p graphql.ResolveParams) *graphqlSession {
+	return p.Context.Value(graphqlSessionKey{}).(*graphqlSession)
+}
+
+func argID(p graphql.ResolveParams, name string) (int64, error) {
+	raw, _ := p.Args[name].(string)
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 1 {
+		return 0, &graphqlError{code: http.StatusBadRequest, message: "ID is not a number"}
+	}
+	return id, nil
+}
+
+// graphqlThunk maps the error of a loader thunk.
+func graphqlThunk(ctx context.Context, thunk func() (any, error)) func() (any, error) {
+	return func() (any, error) {
+		v, err := thunk()
+		if err != nil {
+			return nil, graphqlErr(ctx, err)
+		}
+		return v, nil
+	}
+}
+
+func graphqlErr(ctx context.Context, err error) error {
+	if errors.Is(err, gql.ErrNotLoaded) {
+		return &graphqlError{code: http.StatusNotFound, message: "Not found"}
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return &graphqlError{code: http.StatusGatewayTimeout, message: "Request timed out"}
+	}
+	code, message := aggregate.Status(err)
+	return &graphqlError{code: code, message: message}
+}
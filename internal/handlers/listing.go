@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+)
+
+// Metadata keys used to pass list parameters to the event-service. A service
+// that applies them itself reports the unpaged total in the totalCountKey
+// response header, and the gateway then skips its own filtering and paging.
+const (
+	limitKey      = "x-list-limit"
+	offsetKey     = "x-list-offset"
+	sortKey       = "x-list-sort"
+	searchKey     = "x-list-q"
+	fromKey       = "x-list-from"
+	toKey         = "x-list-to"
+	totalCountKey = "x-total-count"
+)
+
+var (
+	ErrInvalidCursor = errors.New("cursor is invalid")
+	ErrInvalidLimit  = errors.New("limit is invalid")
+	ErrInvalidPage   = errors.New("page is invalid")
+	ErrInvalidSort   = errors.New("sort is invalid")
+	ErrInvalidRange  = errors.New("date range is invalid")
+)
+
+// maxPage is the largest ?page accepted, as documented in the OpenAPI spec.
+const maxPage = 1_000_000
+
+var sortFields = map[string]func(a, b *pb.EventElem) int{
+	"date": func(a, b *pb.EventElem) int {
+		return a.GetStartDate().AsTime().Compare(b.GetStartDate().AsTime())
+	},
+	"title": func(a, b *pb.EventElem) int {
+		return strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+	},
+	"capacity": func(a, b *pb.EventElem) int {
+		return int(a.MaxAttendees) - int(b.MaxAttendees)
+	},
+}
+
+type listQuery struct {
+	// paged is set when the client asked for a page. Lists were returned
+	// whole before pagination was added, so they still are without it.
+	paged    bool
+	limit    int
+	offset   int
+	pageMode bool
+	sort     string
+	desc     bool
+	search   string
+	from     time.Time
+	to       time.Time
+	// export is set for ?format=csv and ?format=ndjson; exports are not paged.
+	export *export
+	expand []string
+}
+
+func parseListQuery(c *gin.Context, config config.Pagination, exportConfig config.Export) (*listQuery, error) {
+	q := &listQuery{limit: config.DefaultLimit}
+
+	export, err := parseExport(c, eventColumns, exportConfig.EventColumns, exportConfig.FlushRows)
+	if err != nil {
+		return nil, err
+	}
+	q.export = export
+
+	if q.expand, err = parseExpand(c, eventExpansions...); err != nil {
+		return nil, err
+	}
+
+	if v := c.Query("page_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, ErrInvalidLimit
+		}
+		q.limit = n
+		q.pageMode = true
+		q.paged = true
+	}
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, ErrInvalidLimit
+		}
+		q.limit = n
+		q.paged = true
+	}
+	q.limit = clampLimit(q.limit, config)
+
+	if v := c.Query("page"); v != "" {
+		n, err := strconv.Atoi(v)
+		// The offset of the page must fit in an int.
+		if err != nil || n < 1 || n > maxPage || n-1 > math.MaxInt/q.limit {
+			return nil, ErrInvalidPage
+		}
+		q.offset = (n - 1) * q.limit
+		q.pageMode = true
+		q.paged = true
+	} else if v := c.Query("cursor"); v != "" {
+		offset, err := decodeCursor(v)
+		if err != nil {
+			return nil, err
+		}
+		q.offset = offset
+		q.paged = true
+	}
+	// Exports are never paged.
+	q.paged = q.paged && q.export == nil
+
+	if v := c.Query("sort"); v != "" {
+		field, desc := strings.CutPrefix(v, "-")
+		if _, ok := sortFields[field]; !ok {
+			return nil, ErrInvalidSort
+		}
+		q.sort, q.desc = field, desc
+	}
+
+	q.search = strings.TrimSpace(c.Query("q"))
+
+	if v := c.Query("from"); v != "" {
+		if q.from, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, ErrInvalidRange
+		}
+	}
+	if v := c.Query("to"); v != "" {
+		if q.to, err = time.Parse(time.RFC3339, v); err != nil {
+			return nil, ErrInvalidRange
+		}
+	}
+	if !q.from.IsZero() && !q.to.IsZero() && q.to.Before(q.from) {
+		return nil, ErrInvalidRange
+	}
+
+	return q, nil
+}
+
+// clampLimit keeps limit within max_limit and above zero, so that a
+// misconfigured max_limit can't produce empty pages.
+func clampLimit(limit int, config config.Pagination) int {
+	return max(min(limit, config.MaxLimit), 1)
+}
+
+// metadata returns the list parameters as outgoing gRPC metadata pairs.
+func (q *listQuery) metadata() []string {
+	var md []string
+	if q.paged {
+		md = append(md,
+			limitKey, strconv.Itoa(q.limit),
+			offsetKey, strconv.Itoa(q.offset),
+		)
+	}
+	if q.sort != "" {
+		sort := q.sort
+		if q.desc {
+			sort = "-" + sort
+		}
+		md = append(md, sortKey, sort)
+	}
+	if q.search != "" {
+		md = append(md, searchKey, q.search)
+	}
+	if !q.from.IsZero() {
+		md = append(md, fromKey, q.from.Format(time.RFC3339))
+	}
+	if !q.to.IsZero() {
+		md = append(md, toKey, q.to.Format(time.RFC3339))
+	}
+	return md
+}
+
+// page returns the requested page of events and the total number of events
+// matching the filters. If the service already paged the result (reported via
+// header metadata), the events are returned as is.
+func (q *listQuery) page(events []*pb.EventElem, header metadata.MD) ([]*pb.EventElem, int) {
+	if values := header.Get(totalCountKey); len(values) > 0 {
+		if total, err := strconv.Atoi(values[0]); err == nil {
+			return events, total
+		}
+	}
+
+	filtered := make([]*pb.EventElem, 0, len(events))
+	for _, e := range events {
+		if q.matches(e) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	if q.sort != "" {
+		cmp := sortFields[q.sort]
+		slices.SortStableFunc(filtered, func(a, b *pb.EventElem) int {
+			if q.desc {
+				return cmp(b, a)
+			}
+			return cmp(a, b)
+		})
+	}
+
+	total := len(filtered)
+	if !q.paged {
+		return filtered, total
+	}
+	start := min(q.offset, total)
+	end := min(start+q.limit, total)
+	return filtered[start:end], total
+}
+
+func (q *listQuery) matches(e *pb.EventElem) bool {
+	if q.search != "" {
+		text := strings.ToLower(e.Title + "\n" + e.About + "\n" + e.Location)
+		if !strings.Contains(text, strings.ToLower(q.search)) {
+			return false
+		}
+	}
+	start := e.GetStartDate().AsTime()
+	if !q.from.IsZero() && start.Before(q.from) {
+		return false
+	}
+	if !q.to.IsZero() && start.After(q.to) {
+		return false
+	}
+	return true
+}
+
+// setHeaders sets X-Total-Count and, for paged lists, the RFC 8288 Link
+// header with first, prev and next relations of the current page.
+func (q *listQuery) setHeaders(c *gin.Context, total int) {
+	c.Header("X-Total-Count", strconv.Itoa(total))
+	if !q.paged {
+		return
+	}
+
+	var links []string
+	links = append(links, q.link(c.Request.URL, 0, "first"))
+	if q.offset > 0 {
+		links = append(links, q.link(c.Request.URL, max(q.offset-q.limit, 0), "prev"))
+	}
+	// Compared without adding to the offset, which a cursor can set to any int.
+	if q.offset < total && total-q.offset > q.limit {
+		links = append(links, q.link(c.Request.URL, q.offset+q.limit, "next"))
+	}
+	// Added, not set, so that the deprecation Link relations are kept.
+	c.Writer.Header().Add("Link", strings.Join(links, ", "))
+}
+
+func (q *listQuery) link(u *url.URL, offset int, rel string) string {
+	values := u.Query()
+	values.Del("cursor")
+	values.Del("page")
+	if q.pageMode {
+		values.Del("limit")
+		values.Set("page", strconv.Itoa(offset/q.limit+1))
+		values.Set("page_size", strconv.Itoa(q.limit))
+	} else {
+		values.Del("page_size")
+		values.Set("limit", strconv.Itoa(q.limit))
+		if offset > 0 {
+			values.Set("cursor", encodeCursor(offset))
+		}
+	}
+	return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, values.Encode(), rel)
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, ErrInvalidCursor
+	}
+	v, ok := strings.CutPrefix(string(raw), "o:")
+	if !ok {
+		return 0, ErrInvalidCursor
+	}
+	offset, err := strconv.Atoi(v)
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+	return offset, nil
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+func testContext(method, target string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(method, target, nil)
+	return c, w
+}
+
+func TestParseListQuery(t *testing.T) {
+	pagination := config.Pagination{DefaultLimit: 20, MaxLimit: 100}
+	exportConfig := config.Export{FlushRows: 50, EventColumns: []string{"id", "title"}}
+
+	tests := []struct {
+		query string
+		want  listQuery
+		err   error
+	}{
+		{"", listQuery{limit: 20}, nil},
+		{"limit=5", listQuery{paged: true, limit: 5}, nil},
+		{"limit=500", listQuery{paged: true, limit: 100}, nil},
+		{"limit=5&cursor=" + encodeCursor(10), listQuery{paged: true, limit: 5, offset: 10}, nil},
+		{"page=3&page_size=10", listQuery{paged: true, limit: 10, offset: 20, pageMode: true}, nil},
+		{"page=2", listQuery{paged: true, limit: 20, offset: 20, pageMode: true}, nil},
+		// page wins over a cursor left in the URL.
+		{"page=2&page_size=5&cursor=" + encodeCursor(50), listQuery{paged: true, limit: 5, offset: 5, pageMode: true}, nil},
+		{"sort=-date", listQuery{limit: 20, sort: "date", desc: true}, nil},
+		{"sort=title", listQuery{limit: 20, sort: "title"}, nil},
+		{"q=+Go+", listQuery{limit: 20, search: "Go"}, nil},
+		{"from=2025-01-01T00:00:00Z&to=2025-01-01T00:00:00Z", listQuery{
+			limit: 20,
+			from:  time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, nil},
+
+		{"limit=0", listQuery{}, ErrInvalidLimit},
+		{"limit=ten", listQuery{}, ErrInvalidLimit},
+		{"page_size=-1", listQuery{}, ErrInvalidLimit},
+		{"page=0", listQuery{}, ErrInvalidPage},
+		{"page=one", listQuery{}, ErrInvalidPage},
+		{"page=1000001", listQuery{}, ErrInvalidPage},
+		{"page=" + strconv.Itoa(math.MaxInt), listQuery{}, ErrInvalidPage},
+		{"page=1000000", listQuery{paged: true, limit: 20, offset: 999_999 * 20, pageMode: true}, nil},
+		{"cursor=!!", listQuery{}, ErrInvalidCursor},
+		{"sort=attendees", listQuery{}, ErrInvalidSort},
+		{"sort=-", listQuery{}, ErrInvalidSort},
+		{"format=xml", listQuery{}, ErrInvalidFormat},
+		{"format=csv&columns=id,password", listQuery{}, ErrInvalidColumns},
+		{"format=csv&limit=5", listQuery{limit: 5, export: &export{format: formatCSV, columns: []string{"id", "title"}, flush: 50}}, nil},
+		{"format=ndjson&columns=title,+status", listQuery{limit: 20, export: &export{format: formatNDJSON, columns: []string{"title", "status"}, flush: 50}}, nil},
+
+		{"from=yesterday", listQuery{}, ErrInvalidRange},
+		{"from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", listQuery{}, ErrInvalidRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			c, _ := testContext(http.MethodGet, "/events/?"+tt.query)
+			got, err := parseListQuery(c, pagination, exportConfig)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if err == nil && !equalListQuery(*got, tt.want) {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseListQueryClampsLimit(t *testing.T) {
+	// A zero max_limit must not make every page empty.
+	for _, query := range []string{"", "limit=5", "page_size=5"} {
+		c, _ := testContext(http.MethodGet, "/events/?"+query)
+		got, err := parseListQuery(c, config.Pagination{}, config.Export{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.limit != 1 {
+			t.Errorf("parseListQuery(%q) limit = %d, want 1", query, got.limit)
+		}
+	}
+}
+
+func equalListQuery(a, b listQuery) bool {
+	return a.paged == b.paged && a.limit == b.limit && a.offset == b.offset && a.pageMode == b.pageMode &&
+		a.sort == b.sort && a.desc == b.desc && a.search == b.search &&
+		a.from.Equal(b.from) && a.to.Equal(b.to) && reflect.DeepEqual(a.export, b.export)
+}
+
+func TestDecodeCursor(t *testing.T) {
+	if offset, err := decodeCursor(encodeCursor(42)); err != nil || offset != 42 {
+		t.Errorf("decodeCursor(encodeCursor(42)) = %d, %v", offset, err)
+	}
+	for _, cursor := range []string{
+		"",
+		"not base64!",
+		"eDo0Mg",   // "x:42"
+		"bzotMQ",   // "o:-1"
+		"bzpmb3J0", // "o:fort"
+	} {
+		if _, err := decodeCursor(cursor); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("decodeCursor(%q) error = %v, want %v", cursor, err, ErrInvalidCursor)
+		}
+	}
+}
+
+func TestListQueryPage(t *testing.T) {
+	day := func(d int) *timestamppb.Timestamp {
+		return timestamppb.New(time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC))
+	}
+	events := []*pb.EventElem{
+		{Id: 1, Title: "Go meetup", StartDate: day(3), MaxAttendees: 30},
+		{Id: 2, Title: "rust night", StartDate: day(1), MaxAttendees: 10, Location: "Berlin"},
+		{Id: 3, Title: "Kotlin", About: "Not about go", StartDate: day(2), MaxAttendees: 20},
+		{Id: 4, Title: "Elm", StartDate: day(5), MaxAttendees: 5},
+	}
+
+	tests := []struct {
+		name   string
+		query  listQuery
+		header metadata.MD
+		ids    []int64
+		total  int
+	}{
+		{"unpaged", listQuery{limit: 2}, nil, []int64{1, 2, 3, 4}, 4},
+		{"first page", listQuery{paged: true, limit: 2}, nil, []int64{1, 2}, 4},
+		{"last page", listQuery{paged: true, limit: 3, offset: 3}, nil, []int64{4}, 4},
+		{"offset past end", listQuery{paged: true, limit: 2, offset: 10}, nil, []int64{}, 4},
+		{"sort by date", listQuery{limit: 10, sort: "date"}, nil, []int64{2, 3, 1, 4}, 4},
+		{"sort by capacity descending", listQuery{limit: 10, sort: "capacity", desc: true}, nil, []int64{1, 3, 2, 4}, 4},
+		{"sort by title ignores case", listQuery{limit: 10, sort: "title"}, nil, []int64{4, 1, 3, 2}, 4},
+		{"search title, about and location", listQuery{limit: 10, search: "GO"}, nil, []int64{1, 3}, 2},
+		{"search location", listQuery{limit: 10, search: "berlin"}, nil, []int64{2}, 1},
+		{"date range is inclusive", listQuery{
+			limit: 10,
+			from:  day(2).AsTime(),
+			to:    day(3).AsTime(),
+		}, nil, []int64{1, 3}, 2},
+		{"total counts every match", listQuery{paged: true, limit: 1, search: "o"}, nil, []int64{1}, 2},
+		{"paged by the service", listQuery{paged: true, limit: 2, search: "nothing"}, metadata.Pairs(totalCountKey, "57"), []int64{1, 2, 3, 4}, 57},
+		{"bad service total ignored", listQuery{paged: true, limit: 2}, metadata.Pairs(totalCountKey, "many"), []int64{1, 2}, 4},
+		{"exports are not paged", listQuery{limit: 1, offset: 1, sort: "date", export: &export{}}, nil, []int64{2, 3, 1, 4}, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, total := tt.query.page(slices.Clone(events), tt.header)
+			ids := make([]int64, len(page))
+			for i, e := range page {
+				ids[i] = e.Id
+			}
+			if !slices.Equal(ids, tt.ids) || total != tt.total {
+				t.Errorf("page() = %v, %d, want %v, %d", ids, total, tt.ids, tt.total)
+			}
+		})
+	}
+}
+
+func TestListQuerySetHeaders(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		query  listQuery
+		total  int
+		link   string
+	}{
+		{
+			name:   "cursor, middle page",
+			target: "/v1/events/?limit=2&cursor=x&q=go",
+			query:  listQuery{paged: true, limit: 2, offset: 2},
+			total:  5,
+			link: `</v1/events/?limit=2&q=go>; rel="first", ` +
+				`</v1/events/?limit=2&q=go>; rel="prev", ` +
+				`</v1/events/?cursor=` + encodeCursor(4) + `&limit=2&q=go>; rel="next"`,
+		},
+		{
+			name:   "cursor, last page",
+			target: "/v1/events/?limit=2",
+			query:  listQuery{paged: true, limit: 2, offset: 4},
+			total:  5,
+			link: `</v1/events/?limit=2>; rel="first", ` +
+				`</v1/events/?cursor=` + encodeCursor(2) + `&limit=2>; rel="prev"`,
+		},
+		{
+			name:   "pages",
+			target: "/v1/events/?page=2&page_size=2&limit=9",
+			query:  listQuery{paged: true, limit: 2, offset: 2, pageMode: true},
+			total:  6,
+			link: `</v1/events/?page=1&page_size=2>; rel="first", ` +
+				`</v1/events/?page=1&page_size=2>; rel="prev", ` +
+				`</v1/events/?page=3&page_size=2>; rel="next"`,
+		},
+		{
+			name:   "single page",
+			target: "/v1/events/?limit=20",
+			query:  listQuery{paged: true, limit: 20},
+			total:  3,
+			link:   `</v1/events/?limit=20>; rel="first"`,
+		},
+		{
+			name:   "unpaged",
+			target: "/v1/events/",
+			query:  listQuery{limit: 20},
+			total:  3,
+		},
+		{
+			// offset+limit would overflow.
+			name:   "cursor far past the end",
+			target: "/v1/events/?limit=20",
+			query:  listQuery{paged: true, limit: 20, offset: math.MaxInt - 5},
+			total:  3,
+			link: `</v1/events/?limit=20>; rel="first", ` +
+				`</v1/events/?cursor=` + encodeCursor(math.MaxInt-25) + `&limit=20>; rel="prev"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, w := testContext(http.MethodGet, tt.target)
+			tt.query.setHeaders(c, tt.total)
+
+			if got := w.Header().Get("Link"); got != tt.link {
+				t.Errorf("Link =\n%s\nwant\n%s", got, tt.link)
+			}
+			if got, want := w.Header().Get("X-Total-Count"), strconv.Itoa(tt.total); got != want {
+				t.Errorf("X-Total-Count = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestListQuerySetHeadersKeepsLinks(t *testing.T) {
+	c, w := testContext(http.MethodGet, "/v1/events/?limit=2")
+	deprecation := `<https://example.com/deprecation>; rel="deprecation"`
+	c.Writer.Header().Add("Link", deprecation)
+	(&listQuery{paged: true, limit: 2}).setHeaders(c, 1)
+
+	if got := w.Header().Values("Link"); len(got) != 2 || got[0] != deprecation {
+		t.Errorf("Link = %q, want the deprecation link kept", got)
+	}
+}
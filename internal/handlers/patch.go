@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"errors"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+)
+
+var ErrUnsupportedPatch = errors.New("unsupported patch media type")
+
+// applyPatch applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// body to doc depending on the request content type.
+func applyPatch(contentType string, doc, body []byte) ([]byte, error) {
+	switch contentType {
+	case MIMEMergePatch:
+		return jsonpatch.MergePatch(doc, body)
+	case MIMEJSONPatch:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return nil, err
+		}
+		return patch.Apply(doc)
+	}
+	return nil, ErrUnsupportedPatch
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// TestApplyPatch runs patches through the same steps as Event.Patch: the
+// current event rendered with every field, the patch, and the result parsed
+// back into an UpdateRequest.
+func TestApplyPatch(t *testing.T) {
+	cd := codec.New(config.Protojson{UseProtoNames: true})
+	current := &pb.UpdateRequest{
+		Id:           7,
+		Title:        "Go meetup",
+		About:        "Talks",
+		StartDate:    &timestamppb.Timestamp{Seconds: 1767261600},
+		Location:     "Berlin",
+		Status:       "open",
+		MaxAttendees: 30,
+	}
+	doc, err := cd.Document(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(change func(r *pb.UpdateRequest)) *pb.UpdateRequest {
+		r := proto.Clone(current).(*pb.UpdateRequest)
+		change(r)
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		patch       string
+		want        *pb.UpdateRequest
+		patchErr    error
+		// invalid is set when the patched document is not an UpdateRequest.
+		invalid bool
+	}{
+		{
+			name:        "merge patch keeps other fields",
+			contentType: MIMEMergePatch,
+			patch:       `{"title":"Gophers"}`,
+			want:        with(func(r *pb.UpdateRequest) { r.Title = "Gophers" }),
+		},
+		{
+			name:        "merge patch null clears a field",
+			contentType: MIMEMergePatch,
+			patch:       `{"location":null,"max_attendees":50}`,
+			want: with(func(r *pb.UpdateRequest) {
+				r.Location = ""
+				r.MaxAttendees = 50
+			}),
+		},
+		{
+			name:        "merge patch can't hide an ID change",
+			contentType: MIMEMergePatch,
+			patch:       `{"id":"8"}`,
+			want:        with(func(r *pb.UpdateRequest) { r.Id = 8 }),
+		},
+		{
+			name:        "merge patch with unknown field",
+			contentType: MIMEMergePatch,
+			patch:       `{"venue":"Paris"}`,
+			invalid:     true,
+		},
+		{
+			name:        "json patch",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op":"test","path":"/status","value":"open"},{"op":"replace","path":"/status","value":"closed"}]`,
+			want:        with(func(r *pb.UpdateRequest) { r.Status = "closed" }),
+		},
+		{
+			name:        "json patch failing test",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op":"test","path":"/status","value":"draft"},{"op":"replace","path":"/status","value":"closed"}]`,
+			patchErr:    errAny,
+		},
+		{
+			name:        "json patch on missing path",
+			contentType: MIMEJSONPatch,
+			patch:       `[{"op":"remove","path":"/venue"}]`,
+			patchErr:    errAny,
+		},
+		{
+			name:        "malformed json patch",
+			contentType: MIMEJSONPatch,
+			patch:       `{"op":"replace"}`,
+			patchErr:    errAny,
+		},
+		{
+			name:        "plain json",
+			contentType: "application/json",
+			patch:       `{"title":"Gophers"}`,
+			patchErr:    ErrUnsupportedPatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patched, err := applyPatch(tt.contentType, doc, []byte(tt.patch))
+			if tt.patchErr != nil {
+				if err == nil || tt.patchErr != errAny && !errors.Is(err, tt.patchErr) {
+					t.Fatalf("applyPatch() error = %v, want %v", err, tt.patchErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyPatch() error = %v", err)
+			}
+
+			var got pb.UpdateRequest
+			err = cd.Unmarshal(patched, &got)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("Unmarshal(%s) succeeded, want an error", patched)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !proto.Equal(&got, tt.want) {
+				t.Errorf("patched = %v, want %v", &got, tt.want)
+			}
+		})
+	}
+}
+
+// errAny stands for any error in the test tables.
+var errAny = errors.New("any error")
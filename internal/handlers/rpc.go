@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/rpc"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	authpb "github.com/Estriper0/protobuf/gen/auth"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// RPC serves the unary methods of the event and auth services over gRPC-Web
+// and Connect and forwards them to the upstreams.
+type RPC struct {
+	logger  *slog.Logger
+	config  *config.Config
+	events  *Event
+	cache   cache.Backend
+	methods []RPCMethod
+}
+
+// RPCMethod is a forwarded upstream method.
+type RPCMethod struct {
+	// Path is the gRPC path of the method, e.g. /event.Event/GetById.
+	Path string
+	// Authenticated methods need the JWT of the caller.
+	Authenticated bool
+	conn          *grpc.ClientConn
+	input         protoreflect.MessageType
+	output        protoreflect.MessageType
+}
+
+// Caller is the authenticated user of a forwarded call.
+type Caller struct {
+	UserID  string
+	IsAdmin bool
+}
+
+// NewRPC creates the handler for every method of the event and auth
+// services. Writes have the same side effects as their REST endpoints.
+func NewRPC(logger *slog.Logger, config *config.Config, events *Event, responseCache cache.Backend) *RPC {
+	eventConn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Event.Host, config.Event.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(err)
+	}
+	authConn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Auth.Host, config.Auth.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(err)
+	}
+
+	r := &RPC{
+		logger: logger,
+		config: config,
+		events: events,
+		cache:  responseCache,
+	}
+	r.methods = append(r.methods, rpcMethods(pb.Event_ServiceDesc, eventConn, true)...)
+	r.methods = append(r.methods, rpcMethods(authpb.Auth_ServiceDesc, authConn, false)...)
+	return r
+}
+
+func rpcMethods(desc grpc.ServiceDesc, conn *grpc.ClientConn, authenticated bool) []RPCMethod {
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(desc.ServiceName))
+	if err != nil {
+		panic(err)
+	}
+	service := d.(protoreflect.ServiceDescriptor)
+
+	methods := make([]RPCMethod, 0, len(desc.Methods))
+	for _, m := range desc.Methods {
+		md := service.Methods().ByName(protoreflect.Name(m.MethodName))
+		input, err := protoregistry.GlobalTypes.FindMessageByName(md.Input().FullName())
+		if err != nil {
+			panic(err)
+		}
+		output, err := protoregistry.GlobalTypes.FindMessageByName(md.Output().FullName())
+		if err != nil {
+			panic(err)
+		}
+		methods = append(methods, RPCMethod{
+			Path:          fmt.Sprintf("/%s/%s", desc.ServiceName, m.MethodName),
+			Authenticated: authenticated,
+			conn:          conn,
+			input:         input,
+			output:        output,
+		})
+	}
+	return methods
+}
+
+// Methods returns the forwarded methods of both services.
+func (r *RPC) Methods() []RPCMethod {
+	return r.methods
+}
+
+// NewInput returns an empty request message of the method.
+func (m RPCMethod) NewInput() proto.Message {
+	return m.input.New().Interface()
+}
+
+// Handle serves a call of the method in the protocol given by Content-Type.
+func (r *RPC) Handle(m RPCMethod) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		protocol, err := rpc.Detect(c.ContentType())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnsupportedMediaType, gin.H{
+				"code":    http.StatusUnsupportedMediaType,
+				"message": "Content-Type must be gRPC-Web or Connect",
+			})
+			return
+		}
+
+		out, header, err := r.call(c, m, protocol)
+		var body []byte
+		if err == nil {
+			if protocol == rpc.ConnectJSON {
+				body, err = protojson.Marshal(out)
+			} else {
+				body, err = proto.Marshal(out)
+			}
+		}
+		if err != nil {
+			if _, ok := status.FromError(err); !ok {
+				r.logger.Error("RPC call failed", slog.String("method", m.Path), slog.String("error", err.Error()))
+				err = status.Error(codes.Internal, "Internal error")
+			}
+		}
+
+		header.Delete("content-type")
+		if protocol.IsGRPCWeb() {
+			rpc.WriteGRPCWeb(c.Writer, protocol, header, body, err)
+		} else {
+			rpc.WriteConnect(c.Writer, protocol, header, body, err)
+		}
+	}
+}
+
+func (r *RPC) call(c *gin.Context, m RPCMethod, protocol rpc.Protocol) (proto.Message, metadata.MD, error) {
+	raw, err := rpc.ReadMessage(protocol, c.Request.Body, int64(r.config.RPC.MaxMessageSize))
+	switch {
+	case errors.Is(err, rpc.ErrMessageTooLarge):
+		return nil, nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, rpc.ErrMalformedFrame):
+		return nil, nil, status.Error(codes.InvalidArgument, err.Error())
+	case err != nil:
+		return nil, nil, err
+	}
+
+	in := m.NewInput()
+	if protocol == rpc.ConnectJSON {
+		err = protojson.Unmarshal(raw, in)
+	} else {
+		err = proto.Unmarshal(raw, in)
+	}
+	if err != nil {
+		return nil, nil, status.Error(codes.InvalidArgument, "Message is incorrect")
+	}
+
+	ctx := c.Request.Context()
+	if t, ok := rpc.Timeout(protocol, c.Request.Header); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t)
+		defer cancel()
+	}
+
+	return r.Forward(ctx, m, in, Caller{UserID: c.GetString("user_id"), IsAdmin: c.GetBool("is_admin")})
+}
+
+// Forward calls the upstream method for the caller. It applies the rules of
+// the REST endpoints: the user is taken from the caller instead of the
+// message, events are changed by their creator only and attendees are shown
+// to admins only. Writes notify webhooks and drop cached responses.
+func (r *RPC) Forward(ctx context.Context, m RPCMethod, in proto.Message, caller Caller) (proto.Message, metadata.MD, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	if err := r.authorize(ctx, caller, in); err != nil {
+		return nil, nil, err
+	}
+
+	out := m.output.New().Interface()
+	var header metadata.MD
+	if err := m.conn.Invoke(ctx, m.Path, in, out, grpc.Header(&header)); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, header, status.Error(codes.DeadlineExceeded, "Request timed out")
+		}
+		return nil, header, err
+	}
+	r.changed(in, out)
+	return out, header, nil
+}
+
+func (r *RPC) authorize(ctx context.Context, caller Caller, in proto.Message) error {
+	switch req := in.(type) {
+	case *pb.CreateRequest:
+		req.Creator = caller.UserID
+	case *pb.RegisterRequest:
+		req.UserId = caller.UserID
+	case *pb.CancellRegisterRequest:
+		req.UserId = caller.UserID
+	case *pb.GetAllByUserRequest:
+		req.UserId = caller.UserID
+	case *pb.UpdateRequest:
+		return r.owned(ctx, caller.UserID, req.Id)
+	case *pb.DeleteByIdRequest:
+		return r.owned(ctx, caller.UserID, req.Id)
+	case *pb.GetAllUsersByEventRequest:
+		if !caller.IsAdmin {
+			return errForbidden
+		}
+	}
+	return nil
+}
+
+func (r *RPC) owned(ctx context.Context, userID string, id int64) error {
+	event, err := r.events.eventClient.GetById(ctx, &pb.GetByIdRequest{Id: id})
+	if err != nil {
+		return err
+	}
+	if event.Creator != userID {
+		return errForbidden
+	}
+	return nil
+}
+
+// changed notifies webhooks and drops cached responses after a write.
+func (r *RPC) changed(in, out proto.Message) {
+	switch req := in.(type) {
+	case *pb.CreateRequest:
+		r.events.publish(webhook.EventCreated, gin.H{"event_id": out.(*pb.CreateResponse).Id, "event": req})
+	case *pb.UpdateRequest:
+		r.events.publish(webhook.EventUpdated, gin.H{"event_id": req.Id, "event": req})
+	case *pb.DeleteByIdRequest:
+		r.events.aggregator.Forget(req.Id)
+		r.events.publish(webhook.EventDeleted, gin.H{"event_id": req.Id})
+	case *pb.RegisterRequest:
+		r.events.aggregator.Forget(req.EventId)
+		r.events.publish(webhook.RegistrationCreated, gin.H{"event_id": req.EventId, "user_id": req.UserId})
+	case *pb.CancellRegisterRequest:
+		r.events.aggregator.Forget(req.EventId)
+		r.events.publish(webhook.RegistrationCancelled, gin.H{"event_id": req.EventId, "user_id": req.UserId})
+	default:
+		return
+	}
+	r.cache.DeletePrefix("events:")
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/watch"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Stream pushes changes of all events as Server-Sent Events.
+func (e *Event) Stream(c *gin.Context) {
+	e.stream(c, "events", e.allEvents)
+}
+
+// StreamById pushes changes of a single event, e.g. its current attendance,
+// as Server-Sent Events.
+func (e *Event) StreamById(c *gin.Context) {
+	id, ok := e.pathID(c)
+	if !ok {
+		return
+	}
+	e.stream(c, eventTopic(int64(id)), e.eventById(int64(id)))
+}
+
+func (e *Event) allEvents(ctx context.Context) ([]*pb.EventElem, error) {
+	resp, err := e.eventClient.GetAll(ctx, &pb.EmptyRequest{})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Events, nil
+}
+
+func (e *Event) eventById(id int64) watch.Source {
+	return func(ctx context.Context) ([]*pb.EventElem, error) {
+		event, err := e.eventClient.GetById(ctx, &pb.GetByIdRequest{Id: id})
+		if status.Code(err) == codes.NotFound {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []*pb.EventElem{eventElem(event)}, nil
+	}
+}
+
+func eventElem(event *pb.GetByIdResponse) *pb.EventElem {
+	return &pb.EventElem{
+		Id:                event.Id,
+		Title:             event.Title,
+		About:             event.About,
+		StartDate:         event.StartDate,
+		Location:          event.Location,
+		Status:            event.Status,
+		MaxAttendees:      event.MaxAttendees,
+		CurrentAttendance: event.CurrentAttendance,
+		Creator:           event.Creator,
+	}
+}
+
+func (e *Event) stream(c *gin.Context, key string, source watch.Source) {
+	userID := c.GetString("user_id")
+	if !e.streams.Acquire(userID) {
+		e.abortWithError(c, http.StatusTooManyRequests, "Too many open streams")
+		return
+	}
+	defer e.streams.Release(userID)
+
+	lastID, err := strconv.ParseUint(c.GetHeader("Last-Event-ID"), 10, 64)
+	sub, backlog, subErr := e.hub.Subscribe(key, source, lastID, err == nil)
+	if errors.Is(subErr, watch.ErrTooManyTopics) {
+		e.abortWithError(c, http.StatusServiceUnavailable, "Too many events are watched")
+		return
+	}
+	if subErr != nil {
+		e.abortWithError(c, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", sse.ContentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", e.config.Stream.Retry.Milliseconds())
+	for _, change := range backlog {
+		if !e.writeChange(c, change) {
+			return
+		}
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(e.config.Stream.Heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case change, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !e.writeChange(c, change) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := c.Writer.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		c.Writer.Flush()
+	}
+}
+
+func (e *Event) writeChange(c *gin.Context, change watch.Change) bool {
+	var obj gin.H
+	if change.Type == watch.ChangeSnapshot {
+		obj = gin.H{"events": change.Events}
+	} else {
+		obj = gin.H{"event": change.Event}
+	}
+	data, err := e.codec.Marshal(obj)
+	if err != nil {
+		return false
+	}
+
+	err = sse.Encode(c.Writer, sse.Event{
+		Id:    strconv.FormatUint(change.ID, 10),
+		Event: change.Type,
+		Data:  string(data),
+	})
+	return err == nil
+}
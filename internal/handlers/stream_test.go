@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/watch"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+)
+
+// readEvents reads SSE events until n have arrived and returns them as
+// "<id> <event>".
+func readEvents(t *testing.T, scanner *bufio.Scanner, n int) []string {
+	t.Helper()
+	var events []string
+	var id string
+	for len(events) < n && scanner.Scan() {
+		line := scanner.Text()
+		if v, ok := strings.CutPrefix(line, "id:"); ok {
+			id = v
+		}
+		if v, ok := strings.CutPrefix(line, "event:"); ok {
+			events = append(events, id+" "+v)
+		}
+	}
+	if len(events) < n {
+		t.Fatalf("stream ended after %v: %v", events, scanner.Err())
+	}
+	return events
+}
+
+func TestStreamResume(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	hub := watch.NewHub(logger, 10*time.Millisecond, time.Second, 10, 16, 0)
+	defer hub.Close()
+	e := &Event{
+		logger: logger,
+		config: &config.Config{Stream: config.Stream{Heartbeat: time.Minute, Retry: time.Second}},
+		codec:  codec.New(config.Protojson{}),
+		hub:    hub,
+		// One stream per user, so the limit is checked too.
+		streams: watch.NewLimiter(1),
+	}
+
+	var mu sync.Mutex
+	attendance := int32(0)
+	source := func(ctx context.Context) ([]*pb.EventElem, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return []*pb.EventElem{{Id: 1, CurrentAttendance: attendance}}, nil
+	}
+	setAttendance := func(n int32) {
+		mu.Lock()
+		attendance = n
+		mu.Unlock()
+	}
+
+	r := gin.New()
+	r.GET("/events/stream", func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		e.stream(c, "events", source)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	open := func(lastEventID string) (*http.Response, context.CancelFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/events/stream", nil)
+		req.Header.Set("X-User", "u1")
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, cancel
+	}
+
+	// Another subscriber keeps the topic and its history alive across the
+	// reconnect.
+	keeper, _, err := hub.Subscribe("events", source, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keeper.Close()
+
+	resp, cancel := open("")
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/event-stream") {
+		t.Errorf("Content-Type = %q", got)
+	}
+	events := bufio.NewScanner(resp.Body)
+	first := readEvents(t, events, 1)
+	setAttendance(1)
+	first = append(first, readEvents(t, events, 1)...)
+	if !strings.HasSuffix(first[0], " snapshot") || !strings.HasSuffix(first[1], " updated") {
+		t.Fatalf("events = %v, want a snapshot and an update", first)
+	}
+
+	second, cancelSecond := open("")
+	if second.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("second stream of the user: status = %d, want %d", second.StatusCode, http.StatusTooManyRequests)
+	}
+	second.Body.Close()
+	cancelSecond()
+
+	// Disconnect after the snapshot, miss two changes and resume.
+	resp.Body.Close()
+	cancel()
+	lastID, _, _ := strings.Cut(first[0], " ")
+	setAttendance(2)
+	time.Sleep(50 * time.Millisecond)
+
+	var resumed []string
+	for deadline := time.Now().Add(time.Second); ; {
+		resp, cancel = open(lastID)
+		if resp.StatusCode == http.StatusOK {
+			break
+		}
+		// The limiter slot is freed once the server notices the disconnect.
+		resp.Body.Close()
+		cancel()
+		if time.Now().After(deadline) {
+			t.Fatalf("resume: status = %d", resp.StatusCode)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	defer cancel()
+	defer resp.Body.Close()
+	resumed = readEvents(t, bufio.NewScanner(resp.Body), 2)
+	if resumed[0] != first[1] || !strings.HasSuffix(resumed[1], " updated") {
+		t.Errorf("resumed events = %v, want %q and the missed update", resumed, first[1])
+	}
+}
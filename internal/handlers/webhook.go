@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	"github.com/gin-gonic/gin"
+)
+
+type Webhook struct {
+	logger     *slog.Logger
+	config     *config.Config
+	codec      *codec.Codec
+	store      webhook.Store
+	dispatcher *webhook.Dispatcher
+}
+
+type createWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"secret"`
+}
+
+func NewWebhook(logger *slog.Logger, config *config.Config, store webhook.Store, dispatcher *webhook.Dispatcher) *Webhook {
+	return &Webhook{
+		logger:     logger,
+		config:     config,
+		codec:      codec.New(config.Protojson),
+		store:      store,
+		dispatcher: dispatcher,
+	}
+}
+
+// Create subscribes a URL to event types. The signing secret is generated
+// unless given and is only returned here.
+func (w *Webhook) Create(c *gin.Context) {
+	if !w.admin(c) {
+		return
+	}
+
+	var req createWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		w.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "JSON is incorrect",
+			},
+		)
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		w.codec.Render(
+			c,
+			http.StatusBadRequest,
+			gin.H{
+				"code":    http.StatusBadRequest,
+				"message": "URL must be an absolute http or https URL",
+			},
+		)
+		return
+	}
+	for _, event := range req.Events {
+		if !slices.Contains(webhook.EventTypes, event) {
+			w.codec.Render(
+				c,
+				http.StatusBadRequest,
+				gin.H{
+					"code":    http.StatusBadRequest,
+					"message": "Unknown event type " + event,
+				},
+			)
+			return
+		}
+	}
+	if req.Secret == "" {
+		req.Secret = webhook.NewID("whsec_")
+	}
+
+	sub := &webhook.Subscription{
+		ID:        webhook.NewID("wh_"),
+		Owner:     c.GetString("user_id"),
+		URL:       req.URL,
+		Events:    slices.Compact(slices.Sorted(slices.Values(req.Events))),
+		Secret:    req.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := w.store.SaveSubscription(sub); err != nil {
+		w.internalError(c, err)
+		return
+	}
+
+	w.codec.Render(
+		c,
+		http.StatusCreated,
+		gin.H{
+			"code":         http.StatusCreated,
+			"message":      "Webhook subscription created",
+			"subscription": sub,
+		},
+	)
+}
+
+func (w *Webhook) GetAll(c *gin.Context) {
+	if !w.admin(c) {
+		return
+	}
+
+	subs, err := w.store.Subscriptions()
+	if err != nil {
+		w.internalError(c, err)
+		return
+	}
+	for _, sub := range subs {
+		sub.Secret = ""
+	}
+
+	w.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":          http.StatusOK,
+			"message":       "Successful getting webhook subscriptions",
+			"subscriptions": subs,
+		},
+	)
+}
+
+func (w *Webhook) GetById(c *gin.Context) {
+	sub, ok := w.subscription(c)
+	if !ok {
+		return
+	}
+	sub.Secret = ""
+
+	w.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":         http.StatusOK,
+			"message":      "Successful getting webhook subscription",
+			"subscription": sub,
+		},
+	)
+}
+
+// DeleteById unsubscribes and drops the deliveries of the subscription,
+// including the pending ones.
+func (w *Webhook) DeleteById(c *gin.Context) {
+	sub, ok := w.subscription(c)
+	if !ok {
+		return
+	}
+	if err := w.store.DeleteSubscription(sub.ID); err != nil {
+		w.internalError(c, err)
+		return
+	}
+
+	w.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":    http.StatusOK,
+			"message": "Webhook subscription deleted",
+		},
+	)
+}
+
+// Deliveries returns the delivery log of a subscription with every attempt.
+func (w *Webhook) Deliveries(c *gin.Context) {
+	sub, ok := w.subscription(c)
+	if !ok {
+		return
+	}
+	deliveries, err := w.store.Deliveries(sub.ID)
+	if err != nil {
+		w.internalError(c, err)
+		return
+	}
+
+	w.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":       http.StatusOK,
+			"message":    "Successful getting webhook deliveries",
+			"deliveries": deliveries,
+		},
+	)
+}
+
+func (w *Webhook) DeadLetters(c *gin.Context) {
+	if !w.admin(c) {
+		return
+	}
+
+	deliveries, err := w.store.DeadLetters()
+	if err != nil {
+		w.internalError(c, err)
+		return
+	}
+
+	w.codec.Render(
+		c,
+		http.StatusOK,
+		gin.H{
+			"code":       http.StatusOK,
+			"message":    "Successful getting dead webhook deliveries",
+			"deliveries": deliveries,
+		},
+	)
+}
+
+// Replay sends a dead delivery again.
+func (w *Webhook) Replay(c *gin.Context) {
+	if !w.admin(c) {
+		return
+	}
+
+	delivery, err := w.dispatcher.Replay(c.Param("id"))
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		w.codec.Render(
+			c,
+			http.StatusNotFound,
+			gin.H{
+				"code":    http.StatusNotFound,
+				"message": "Not found",
+			},
+		)
+		return
+	case errors.Is(err, webhook.ErrNotDead):
+		w.codec.Render(
+			c,
+			http.StatusConflict,
+			gin.H{
+				"code":    http.StatusConflict,
+				"message": "Only dead deliveries can be replayed",
+			},
+		)
+		return
+	case err != nil:
+		w.internalError(c, err)
+		return
+	}
+
+	w.codec.Render(
+		c,
+		http.StatusAccepted,
+		gin.H{
+			"code":     http.StatusAccepted,
+			"message":  "Delivery queued for replay",
+			"delivery": delivery,
+		},
+	)
+}
+
+// admin checks that the user is an administrator: webhooks expose every
+// event and registration, so only administrators manage them.
+func (w *Webhook) admin(c *gin.Context) bool {
+	if !c.GetBool("is_admin") {
+		w.codec.Render(
+			c,
+			http.StatusForbidden,
+			gin.H{
+				"code":    http.StatusForbidden,
+				"message": "The user does not have access to the requested resource.",
+			},
+		)
+		return false
+	}
+	return true
+}
+
+func (w *Webhook) subscription(c *gin.Context) (*webhook.Subscription, bool) {
+	if !w.admin(c) {
+		return nil, false
+	}
+
+	sub, err := w.store.Subscription(c.Param("id"))
+	if errors.Is(err, webhook.ErrNotFound) {
+		w.codec.Render(
+			c,
+			http.StatusNotFound,
+			gin.H{
+				"code":    http.StatusNotFound,
+				"message": "Not found",
+			},
+		)
+		return nil, false
+	}
+	if err != nil {
+		w.internalError(c, err)
+		return nil, false
+	}
+	return sub, true
+}
+
+func (w *Webhook) internalError(c *gin.Context, err error) {
+	w.logger.Error("Webhook store failed", slog.String("error", err.Error()))
+	w.codec.Render(
+		c,
+		http.StatusInternalServerError,
+		gin.H{
+			"code":    http.StatusInternalServerError,
+			"message": "Internal error",
+		},
+	)
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/session"
+	"github.com/Estriper0/eventhub_gateway/internal/token"
+	"github.com/Estriper0/eventhub_gateway/internal/watch"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	"github.com/Estriper0/eventhub_gateway/internal/ws"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// bearerSubprotocol prefixes the access token passed as a websocket
+// subprotocol by browsers, which can't set the Authorization header.
+const bearerSubprotocol = "bearer."
+
+const (
+	wsAuth           = "auth"
+	wsSubscribe      = "subscribe"
+	wsUnsubscribe    = "unsubscribe"
+	wsRegister       = "register"
+	wsCancelRegister = "cancel_register"
+	wsPing           = "ping"
+)
+
+type wsRequest struct {
+	Type      string `json:"type"`
+	RequestID string `json:"request_id,omitempty"`
+	Token     string `json:"token,omitempty"`
+	EventID   int64  `json:"event_id,omitempty"`
+}
+
+type wsSession struct {
+	e       *Event
+	conn    *ws.Conn
+	userID  string
+	isAdmin bool
+
+	// ctx lives as long as the connection and bounds the calls it makes.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	subs map[int64]*watch.Subscription
+}
+
+// WebSocket serves a socket on which clients subscribe to changes of events
+// and register for them. The client authenticates with the Authorization
+// header, the access token cookie of a session, a "bearer.<token>"
+// subprotocol or an auth message sent first.
+func (e *Event) WebSocket(c *gin.Context) {
+	var claims map[string]any
+	var err error
+	if header := c.GetHeader("Authorization"); header != "" {
+		tokenString, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+			return
+		}
+		if claims, err = token.Parse(tokenString, e.config.AccessTokenSecret); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+			return
+		}
+	} else if accessToken := session.AccessToken(c, e.config.Session); accessToken != "" {
+		if !session.AllowedOrigin(c, e.config.Session) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origin is not allowed"})
+			return
+		}
+		if claims, err = token.Parse(accessToken, e.config.AccessTokenSecret); err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+			return
+		}
+	} else {
+		for _, protocol := range websocket.Subprotocols(c.Request) {
+			if tokenString, ok := strings.CutPrefix(protocol, bearerSubprotocol); ok {
+				if claims, err = token.Parse(tokenString, e.config.AccessTokenSecret); err != nil {
+					c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+					return
+				}
+			}
+		}
+	}
+
+	conn, err := e.sockets.Upgrade(c.Writer, c.Request, nil)
+	if errors.Is(err, ws.ErrClosed) {
+		e.abortWithError(c, http.StatusServiceUnavailable, "Server is shutting down")
+		return
+	}
+	if err != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	s := &wsSession{
+		e:      e,
+		conn:   conn,
+		ctx:    ctx,
+		cancel: cancel,
+		subs:   make(map[int64]*watch.Subscription),
+	}
+	defer s.close()
+
+	if claims == nil {
+		if claims = s.authenticate(); claims == nil {
+			return
+		}
+	}
+	s.userID, _ = claims["user_id"].(string)
+	s.isAdmin, _ = claims["is_admin"].(bool)
+
+	if !e.socketLimit.Acquire(s.userID) {
+		s.send(gin.H{"type": "error", "message": "Too many open connections"})
+		conn.Close(websocket.ClosePolicyViolation, "too many connections")
+		return
+	}
+	defer e.socketLimit.Release(s.userID)
+
+	s.send(gin.H{"type": "welcome", "user_id": s.userID})
+	s.run()
+}
+
+// authenticate waits for the auth message and returns the token claims, or
+// nil after closing the connection.
+func (s *wsSession) authenticate() map[string]any {
+	s.conn.SetReadDeadline(time.Now().Add(s.e.config.WebSocket.AuthTimeout))
+	msg, err := s.conn.Read()
+	if err != nil {
+		s.conn.Close(websocket.ClosePolicyViolation, "authentication timed out")
+		return nil
+	}
+
+	var req wsRequest
+	if err := json.Unmarshal(msg, &req); err != nil || req.Type != wsAuth {
+		s.conn.Close(websocket.ClosePolicyViolation, "authentication required")
+		return nil
+	}
+	claims, err := token.Parse(req.Token, s.e.config.AccessTokenSecret)
+	if err != nil {
+		s.send(gin.H{"type": "error", "request_id": req.RequestID, "message": "Invalid token", "details": err.Error()})
+		s.conn.Close(websocket.ClosePolicyViolation, "invalid token")
+		return nil
+	}
+	s.conn.SetReadDeadline(time.Now().Add(s.e.config.WebSocket.PongWait))
+	return claims
+}
+
+func (s *wsSession) run() {
+	for {
+		msg, err := s.conn.Read()
+		if err != nil {
+			s.conn.Close(websocket.CloseNormalClosure, "")
+			return
+		}
+
+		var req wsRequest
+		if err := json.Unmarshal(msg, &req); err != nil {
+			s.send(gin.H{"type": "error", "message": "Message is not valid JSON"})
+			continue
+		}
+
+		switch req.Type {
+		case wsSubscribe:
+			s.subscribe(req)
+		case wsUnsubscribe:
+			s.unsubscribe(req)
+		case wsRegister, wsCancelRegister:
+			s.register(req)
+		case wsPing:
+			s.send(gin.H{"type": "pong", "request_id": req.RequestID})
+		default:
+			s.send(gin.H{"type": "error", "request_id": req.RequestID, "message": "Unknown message type"})
+		}
+	}
+}
+
+func (s *wsSession) subscribe(req wsRequest) {
+	if req.EventID < 1 {
+		s.send(gin.H{"type": "error", "request_id": req.RequestID, "message": "event_id is invalid"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subs[req.EventID]; ok {
+		s.send(gin.H{"type": "subscribed", "request_id": req.RequestID, "event_id": req.EventID})
+		return
+	}
+	if len(s.subs) >= s.e.config.WebSocket.MaxSubscriptions {
+		s.send(gin.H{"type": "error", "request_id": req.RequestID, "message": "Too many subscriptions"})
+		return
+	}
+
+	sub, backlog, err := s.e.hub.Subscribe(eventTopic(req.EventID), s.e.eventById(req.EventID), 0, false)
+	if errors.Is(err, watch.ErrTooManyTopics) {
+		s.send(gin.H{"type": "error", "request_id": req.RequestID, "message": "Too many events are watched"})
+		return
+	}
+	if err != nil {
+		s.conn.Close(websocket.CloseGoingAway, "server is shutting down")
+		return
+	}
+	s.subs[req.EventID] = sub
+	s.send(gin.H{"type": "subscribed", "request_id": req.RequestID, "event_id": req.EventID})
+
+	go s.forward(req.EventID, sub, backlog)
+}
+
+// forward sends the changes of a subscription until it is closed. A
+// subscription closed by the hub rather than by unsubscribe means the client
+// is too slow or the server is stopping, and ends the connection.
+func (s *wsSession) forward(eventID int64, sub *watch.Subscription, backlog []watch.Change) {
+	for _, change := range backlog {
+		s.sendChange(eventID, change)
+	}
+	for change := range sub.C {
+		if !s.sendChange(eventID, change) {
+			return
+		}
+	}
+
+	s.mu.Lock()
+	// The event may have been unsubscribed and subscribed again meanwhile.
+	subscribed := s.subs[eventID] == sub
+	s.mu.Unlock()
+	if subscribed {
+		s.conn.Close(websocket.CloseTryAgainLater, "subscription was dropped")
+	}
+}
+
+func (s *wsSession) sendChange(eventID int64, change watch.Change) bool {
+	// A snapshot of a single event holds the event, or nothing if it doesn't exist.
+	event := change.Event
+	if change.Type == watch.ChangeSnapshot && len(change.Events) > 0 {
+		event = change.Events[0]
+	}
+	return s.send(gin.H{"type": change.Type, "id": change.ID, "event_id": eventID, "event": event})
+}
+
+func (s *wsSession) unsubscribe(req wsRequest) {
+	s.mu.Lock()
+	sub, ok := s.subs[req.EventID]
+	delete(s.subs, req.EventID)
+	s.mu.Unlock()
+
+	if ok {
+		sub.Close()
+	}
+	s.send(gin.H{"type": "unsubscribed", "request_id": req.RequestID, "event_id": req.EventID})
+}
+
+// register registers the user for an event or cancels the registration and
+// replies with a confirmation or an error carrying the HTTP status the REST
+// endpoint would return.
+func (s *wsSession) register(req wsRequest) {
+	if req.EventID < 1 {
+		s.send(gin.H{"type": "error", "request_id": req.RequestID, "code": http.StatusBadRequest, "message": "event_id is invalid"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, s.e.config.Timeout)
+	defer cancel()
+
+	var err error
+	confirmation := "registered"
+	if req.Type == wsRegister {
+		_, err = s.e.eventClient.Register(ctx, &pb.RegisterRequest{UserId: s.userID, EventId: req.EventID})
+	} else {
+		confirmation = "registration_cancelled"
+		_, err = s.e.eventClient.CancellRegister(ctx, &pb.CancellRegisterRequest{UserId: s.userID, EventId: req.EventID})
+	}
+	if err != nil {
+		code, message := registrationError(ctx, err)
+		s.send(gin.H{"type": "error", "request_id": req.RequestID, "event_id": req.EventID, "code": code, "message": message})
+		return
+	}
+
+	event := webhook.RegistrationCreated
+	if req.Type == wsCancelRegister {
+		event = webhook.RegistrationCancelled
+	}
+	s.e.aggregator.Forget(req.EventID)
+	s.e.publish(event, gin.H{"event_id": req.EventID, "user_id": s.userID})
+	// Unlike REST writes, socket messages don't pass the cache middleware.
+	s.e.cache.DeletePrefix("events:")
+
+	s.send(gin.H{"type": confirmation, "request_id": req.RequestID, "event_id": req.EventID})
+}
+
+func (s *wsSession) send(obj gin.H) bool {
+	if obj["request_id"] == "" {
+		delete(obj, "request_id")
+	}
+	msg, err := s.e.codec.Marshal(obj)
+	if err != nil {
+		return false
+	}
+	return s.conn.Send(msg)
+}
+
+func (s *wsSession) close() {
+	s.cancel()
+	s.mu.Lock()
+	subs := s.subs
+	s.subs = nil
+	s.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+	s.conn.Close(websocket.CloseNormalClosure, "")
+}
+
+func eventTopic(id int64) string {
+	return "events/" + strconv.FormatInt(id, 10)
+}
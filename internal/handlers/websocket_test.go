@@ -0,0 +1,346 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/aggregate"
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/watch"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	"github.com/Estriper0/eventhub_gateway/internal/ws"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const testAccessSecret = "access-secret"
+
+// fakeEventClient implements the event-service calls the tests need; the
+// others panic through the nil embedded interface.
+type fakeEventClient struct {
+	pb.EventClient
+	events map[int64]*pb.GetByIdResponse
+	// err, if set, fails GetById.
+	err error
+}
+
+func (f *fakeEventClient) GetById(ctx context.Context, in *pb.GetByIdRequest, opts ...grpc.CallOption) (*pb.GetByIdResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	event, ok := f.events[in.Id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "event not found")
+	}
+	return event, nil
+}
+
+func (f *fakeEventClient) Register(ctx context.Context, in *pb.RegisterRequest, opts ...grpc.CallOption) (*pb.EmptyResponse, error) {
+	if _, ok := f.events[in.EventId]; !ok {
+		return nil, status.Error(codes.NotFound, "event not found")
+	}
+	if in.UserId == "full" {
+		return nil, status.Error(codes.ResourceExhausted, "event is full")
+	}
+	return &pb.EmptyResponse{}, nil
+}
+
+func signAccessToken(t *testing.T, secret, userID string) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id": userID,
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newWebSocketServer(t *testing.T) (string, *Event) {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{
+		AccessTokenSecret: testAccessSecret,
+		Timeout:           time.Second,
+		Session:           config.Session{Enabled: true, AccessCookie: "access_token"},
+		WebSocket: config.WebSocket{
+			Subprotocols:     []string{"eventhub.v1"},
+			AuthTimeout:      time.Second,
+			PingInterval:     time.Minute,
+			PongWait:         time.Minute,
+			WriteWait:        time.Second,
+			SendQueue:        16,
+			MaxMessageSize:   4096,
+			MaxSubscriptions: 2,
+			MaxPerUser:       1,
+		},
+	}
+	hub := watch.NewHub(logger, 10*time.Millisecond, time.Second, 10, 16, 0)
+	sockets := ws.NewManager(cfg.WebSocket)
+	webhooks := webhook.NewDispatcher(logger, webhook.NewMemoryStore(0), config.Webhooks{})
+	events := &fakeEventClient{events: map[int64]*pb.GetByIdResponse{
+		1: {Id: 1, Title: "Go meetup"},
+		2: {Id: 2, Title: "Rust night"},
+	}}
+	e := &Event{
+		logger:      logger,
+		config:      cfg,
+		codec:       codec.New(config.Protojson{UseProtoNames: true}),
+		hub:         hub,
+		sockets:     sockets,
+		socketLimit: watch.NewLimiter(cfg.WebSocket.MaxPerUser),
+		webhooks:    webhooks,
+		aggregator:  aggregate.New(config.Expand{}, nil, events),
+		cache:       cache.NewLRU(16),
+		eventClient: events,
+	}
+
+	r := gin.New()
+	r.GET("/ws", e.WebSocket)
+	srv := httptest.NewServer(r)
+	t.Cleanup(func() {
+		sockets.Close()
+		hub.Close()
+		webhooks.Close()
+		srv.Close()
+	})
+	return "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws", e
+}
+
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+}
+
+func dialWebSocket(t *testing.T, url string, header http.Header, protocols ...string) (*wsClient, *http.Response, error) {
+	t.Helper()
+	dialer := websocket.Dialer{Subprotocols: protocols}
+	conn, resp, err := dialer.Dial(url, header)
+	if err != nil {
+		return nil, resp, err
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn}, resp, nil
+}
+
+func (c *wsClient) send(msg string) {
+	c.t.Helper()
+	if err := c.conn.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// expect reads the next message and checks that it has the given type.
+func (c *wsClient) expect(typ string) map[string]any {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, b, err := c.conn.ReadMessage()
+	if err != nil {
+		c.t.Fatalf("waiting for %s: %v", typ, err)
+	}
+	var msg map[string]any
+	if err := json.Unmarshal(b, &msg); err != nil {
+		c.t.Fatal(err)
+	}
+	if msg["type"] != typ {
+		c.t.Fatalf("message = %s, want type %s", b, typ)
+	}
+	return msg
+}
+
+// expectClose reads until the connection is closed and returns the close code.
+func (c *wsClient) expectClose() int {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			var closeErr *websocket.CloseError
+			if !errors.As(err, &closeErr) {
+				c.t.Fatalf("read error = %v, want a close frame", err)
+			}
+			return closeErr.Code
+		}
+	}
+}
+
+func TestWebSocketAuth(t *testing.T) {
+	url, _ := newWebSocketServer(t)
+	// Every subtest connects as another user, so the per-user connection
+	// limit doesn't depend on when the server notices a disconnect.
+	token := func(userID string) string { return signAccessToken(t, testAccessSecret, userID) }
+
+	t.Run("header", func(t *testing.T) {
+		c, _, err := dialWebSocket(t, url, http.Header{"Authorization": {"Bearer " + token("u1")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := c.expect("welcome"); msg["user_id"] != "u1" {
+			t.Errorf("welcome = %v", msg)
+		}
+		c.conn.Close()
+	})
+
+	t.Run("header from another origin", func(t *testing.T) {
+		c, _, err := dialWebSocket(t, url, http.Header{
+			"Authorization": {"Bearer " + token("u4")},
+			"Origin":        {"https://evil.example"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.expect("welcome")
+		c.conn.Close()
+	})
+
+	t.Run("cookie", func(t *testing.T) {
+		c, _, err := dialWebSocket(t, url, http.Header{"Cookie": {"access_token=" + token("u5")}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg := c.expect("welcome"); msg["user_id"] != "u5" {
+			t.Errorf("welcome = %v", msg)
+		}
+		c.conn.Close()
+	})
+
+	t.Run("cookie from another origin", func(t *testing.T) {
+		_, resp, err := dialWebSocket(t, url, http.Header{
+			"Cookie": {"access_token=" + token("u6")},
+			"Origin": {"https://evil.example"},
+		})
+		if err == nil || resp == nil || resp.StatusCode != http.StatusForbidden {
+			t.Fatalf("dial error = %v, want 403", err)
+		}
+	})
+
+	t.Run("bad header", func(t *testing.T) {
+		_, resp, err := dialWebSocket(t, url, http.Header{"Authorization": {"Bearer " + signAccessToken(t, "other", "u1")}})
+		if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+			t.Fatalf("dial error = %v, want 401", err)
+		}
+	})
+
+	t.Run("subprotocol", func(t *testing.T) {
+		c, resp, err := dialWebSocket(t, url, nil, "eventhub.v1", bearerSubprotocol+token("u2"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != "eventhub.v1" {
+			t.Errorf("negotiated subprotocol = %q, want eventhub.v1 and never the token", got)
+		}
+		c.expect("welcome")
+		c.conn.Close()
+	})
+
+	t.Run("auth message", func(t *testing.T) {
+		c, _, err := dialWebSocket(t, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.send(`{"type":"auth","token":"` + token("u3") + `"}`)
+		c.expect("welcome")
+		c.conn.Close()
+	})
+
+	t.Run("invalid token message", func(t *testing.T) {
+		c, _, err := dialWebSocket(t, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.send(`{"type":"auth","request_id":"a1","token":"nope"}`)
+		if msg := c.expect("error"); msg["request_id"] != "a1" {
+			t.Errorf("error = %v, want request_id a1", msg)
+		}
+		if code := c.expectClose(); code != websocket.ClosePolicyViolation {
+			t.Errorf("close code = %d, want %d", code, websocket.ClosePolicyViolation)
+		}
+	})
+
+	t.Run("other message first", func(t *testing.T) {
+		c, _, err := dialWebSocket(t, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.send(`{"type":"ping"}`)
+		if code := c.expectClose(); code != websocket.ClosePolicyViolation {
+			t.Errorf("close code = %d, want %d", code, websocket.ClosePolicyViolation)
+		}
+	})
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	url, e := newWebSocketServer(t)
+	header := http.Header{"Authorization": {"Bearer " + signAccessToken(t, testAccessSecret, "u1")}}
+	c, _, err := dialWebSocket(t, url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.expect("welcome")
+
+	c.send(`{"type":"ping","request_id":"p1"}`)
+	if msg := c.expect("pong"); msg["request_id"] != "p1" {
+		t.Errorf("pong = %v", msg)
+	}
+	c.send(`not json`)
+	c.expect("error")
+	c.send(`{"type":"dance"}`)
+	c.expect("error")
+
+	c.send(`{"type":"subscribe","request_id":"s1","event_id":1}`)
+	if msg := c.expect("subscribed"); msg["event_id"] != float64(1) {
+		t.Errorf("subscribed = %v", msg)
+	}
+	snapshot := c.expect("snapshot")
+	if event, _ := snapshot["event"].(map[string]any); event["title"] != "Go meetup" {
+		t.Errorf("snapshot = %v", snapshot)
+	}
+
+	c.send(`{"type":"subscribe","event_id":2}`)
+	c.expect("subscribed")
+	c.expect("snapshot")
+	c.send(`{"type":"subscribe","request_id":"s3","event_id":3}`)
+	if msg := c.expect("error"); msg["message"] != "Too many subscriptions" {
+		t.Errorf("third subscription = %v", msg)
+	}
+	c.send(`{"type":"unsubscribe","event_id":2}`)
+	c.expect("unsubscribed")
+
+	e.cache.Set("events:GET /v1/events/1", &cache.Entry{ExpiresAt: time.Now().Add(time.Minute)})
+	c.send(`{"type":"register","request_id":"r1","event_id":1}`)
+	if msg := c.expect("registered"); msg["request_id"] != "r1" {
+		t.Errorf("registered = %v", msg)
+	}
+	if _, ok := e.cache.Get("events:GET /v1/events/1"); ok {
+		t.Error("cached event response kept after a registration")
+	}
+	c.send(`{"type":"register","request_id":"r2","event_id":9}`)
+	if msg := c.expect("error"); msg["code"] != float64(http.StatusNotFound) {
+		t.Errorf("register of a missing event = %v, want code 404", msg)
+	}
+
+	// The connection limit is one per user.
+	second, _, err := dialWebSocket(t, url, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.expect("error")
+	if code := second.expectClose(); code != websocket.ClosePolicyViolation {
+		t.Errorf("second connection close code = %d, want %d", code, websocket.ClosePolicyViolation)
+	}
+}
@@ -0,0 +1,114 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MIMECalendar = "text/calendar"
+
+	timeFormat = "20060102T150405Z"
+	lineLimit  = 75
+)
+
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Status      string
+	Start       time.Time
+}
+
+// Writer writes an RFC 5545 VCALENDAR with one VEVENT per WriteEvent call.
+// Lines end with CRLF and are folded at 75 octets.
+type Writer struct {
+	w     *bufio.Writer
+	stamp string
+	err   error
+}
+
+// NewWriter writes the calendar header; name is shown by clients as the
+// calendar title.
+func NewWriter(w io.Writer, prodID, name string) *Writer {
+	cw := &Writer{
+		w:     bufio.NewWriter(w),
+		stamp: time.Now().UTC().Format(timeFormat),
+	}
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", prodID)
+	cw.line("CALSCALE", "GREGORIAN")
+	cw.line("METHOD", "PUBLISH")
+	if name != "" {
+		cw.line("X-WR-CALNAME", escape(name))
+	}
+	return cw
+}
+
+func (cw *Writer) WriteEvent(e Event) error {
+	cw.line("BEGIN", "VEVENT")
+	cw.line("UID", e.UID)
+	cw.line("DTSTAMP", cw.stamp)
+	if !e.Start.IsZero() {
+		cw.line("DTSTART", e.Start.UTC().Format(timeFormat))
+	}
+	cw.line("SUMMARY", escape(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION", escape(e.Description))
+	}
+	if e.Location != "" {
+		cw.line("LOCATION", escape(e.Location))
+	}
+	if e.Status != "" {
+		cw.line("STATUS", e.Status)
+	}
+	cw.line("END", "VEVENT")
+	return cw.err
+}
+
+// Close writes the calendar footer and flushes the output.
+func (cw *Writer) Close() error {
+	cw.line("END", "VCALENDAR")
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+func (cw *Writer) line(name, value string) {
+	if cw.err != nil {
+		return
+	}
+	s := name + ":" + value
+	for len(s) > lineLimit {
+		cut := lineLimit
+		for cut > 0 && !utf8.RuneStart(s[cut]) {
+			cut--
+		}
+		if _, cw.err = cw.w.WriteString(s[:cut] + "\r\n"); cw.err != nil {
+			return
+		}
+		// The continuation line starts with a space, which counts against the limit.
+		s = " " + s[cut:]
+	}
+	_, cw.err = cw.w.WriteString(s + "\r\n")
+}
+
+var replacer = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+// escape escapes a TEXT value (RFC 5545, section 3.3.11).
+func escape(s string) string {
+	return replacer.Replace(s)
+}
@@ -0,0 +1,72 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b, "-//eventhub//gateway//EN", "My events")
+	err := w.WriteEvent(Event{
+		UID:         "7@eventhub",
+		Summary:     "Go; Rust, and C\\C++",
+		Description: "Line one\nLine two",
+		Status:      "CONFIRMED",
+		Start:       time.Date(2026, 1, 1, 10, 0, 0, 0, time.FixedZone("CET", 3600)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+
+	for _, line := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"X-WR-CALNAME:My events\r\n",
+		"UID:7@eventhub\r\n",
+		"DTSTART:20260101T090000Z\r\n",
+		`SUMMARY:Go\; Rust\, and C\\C++` + "\r\n",
+		`DESCRIPTION:Line one\nLine two` + "\r\n",
+		"STATUS:CONFIRMED\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("calendar has no line %q:\n%s", line, out)
+		}
+	}
+	if strings.Contains(out, "LOCATION") {
+		t.Error("empty location is written")
+	}
+	if !strings.HasSuffix(out, "END:VEVENT\r\nEND:VCALENDAR\r\n") {
+		t.Errorf("calendar ends with %q", out[len(out)-30:])
+	}
+}
+
+func TestWriterFoldsLongLines(t *testing.T) {
+	var b strings.Builder
+	w := NewWriter(&b, "-//eventhub//gateway//EN", "")
+	summary := strings.Repeat("ü", 100)
+	w.WriteEvent(Event{UID: "1", Summary: summary})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var unfolded strings.Builder
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		if len(line) > lineLimit {
+			t.Errorf("line of %d octets: %q", len(line), line)
+		}
+		if cont, ok := strings.CutPrefix(line, " "); ok {
+			unfolded.WriteString(cont)
+			continue
+		}
+		unfolded.WriteString("\n" + line)
+	}
+	if !strings.Contains(unfolded.String(), "\nSUMMARY:"+summary+"\n") {
+		t.Errorf("unfolded calendar has no full summary:\n%s", unfolded.String())
+	}
+}
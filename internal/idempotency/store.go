@@ -0,0 +1,34 @@
+package idempotency
+
+import (
+	"net/http"
+	"time"
+)
+
+// Response is a stored HTTP response replayed for retried requests.
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Record is the state of an idempotency key. Response is nil while the first
+// request with the key is still in flight.
+type Record struct {
+	Fingerprint string
+	Response    *Response
+}
+
+// Store keeps idempotency records. Implementations must make Lock atomic so
+// that only one of several concurrent requests with the same key executes.
+type Store interface {
+	// Lock creates an in-flight record for key if there is none and reports
+	// true, otherwise it returns the existing record and false.
+	Lock(key, fingerprint string, ttl time.Duration) (*Record, bool, error)
+	// Get returns the record for key or nil if there is none.
+	Get(key string) (*Record, error)
+	// Save stores the response of the in-flight request for key.
+	Save(key string, response *Response, ttl time.Duration) error
+	// Unlock removes the in-flight record so the key can be retried.
+	Unlock(key string) error
+}
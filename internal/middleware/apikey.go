@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyKey holds the key verified by RateLimiterMiddleware.
+const apiKeyKey = "api_key"
+
+// APIKeyMiddleware authenticates requests with an API key in the configured
+// header as the owner of the key and hands the others to next, usually
+// JWTAuthMiddleware. Keys need the "<resource>:read" scope for safe methods
+// and "<resource>:write" otherwise. Their tier limit is applied by
+// RateLimiterMiddleware.
+func APIKeyMiddleware(verifier *apikey.Verifier, keys config.APIKeys, resource string, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.GetHeader(keys.Header)
+		if raw == "" {
+			next(c)
+			return
+		}
+
+		var key *apikey.Key
+		if v, ok := c.Get(apiKeyKey); ok {
+			key = v.(*apikey.Key)
+		} else {
+			var err error
+			key, err = verifier.Verify(raw)
+			if errors.Is(err, apikey.ErrInvalid) || errors.Is(err, apikey.ErrExpired) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Internal error"})
+				return
+			}
+		}
+
+		scope := resource + ":write"
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			scope = resource + ":read"
+		}
+		if !key.Allows(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + scope + " scope"})
+			return
+		}
+
+		c.Set("user_id", key.Owner)
+		c.Set("is_admin", key.Allows(apikey.ScopeAdmin))
+		c.Set("api_key_id", key.ID)
+		c.Next()
+	}
+}
@@ -1,52 +1,109 @@
 package middleware
 
 import (
-	"fmt"
+	"errors"
 	"net/http"
 	"strings"
 
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/feed"
+	"github.com/Estriper0/eventhub_gateway/internal/session"
+	"github.com/Estriper0/eventhub_gateway/internal/token"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func JWTAuthMiddleware(secretKey string) gin.HandlerFunc {
+// JWTAuthMiddleware authenticates requests by the Bearer access token,
+// falling back to the session cookies.
+func JWTAuthMiddleware(secretKey string, cookies config.Session, refresher *session.Refresher) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			return
+		if authenticate(c, secretKey, cookies, refresher) {
+			c.Next()
 		}
+	}
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+// FeedAuthMiddleware authenticates calendar feed requests by the feed token in
+// the token query parameter, falling back to the Bearer access token. It
+// doesn't call c.Next, so it can also run in ExtensionMiddleware.
+func FeedAuthMiddleware(signer *feed.Signer, secretKey string, cookies config.Session, refresher *session.Refresher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			authenticate(c, secretKey, cookies, refresher)
 			return
 		}
 
-		tokenString := parts[1]
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(secretKey), nil
-		})
-
+		userID, err := signer.Verify(token)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid feed token", "details": err.Error()})
 			return
 		}
+		c.Set("user_id", userID)
+		c.Set("is_admin", false)
+	}
+}
 
-		if !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is not valid"})
-			return
-		}
+// authenticate validates the Bearer access token, or the session cookies if
+// there is no Authorization header, and stores its claims in the context.
+// It aborts the request and returns false if the token is invalid.
+func authenticate(c *gin.Context, secretKey string, cookies config.Session, refresher *session.Refresher) bool {
+	authHeader := c.GetHeader("Authorization")
+	if authHeader == "" && session.Active(c, cookies) {
+		return authenticateSession(c, secretKey, cookies, refresher)
+	}
+	if authHeader == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+		return false
+	}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", claims["user_id"])
-			c.Set("is_admin", claims["is_admin"])
-		}
+	parts := strings.Split(authHeader, " ")
+	if len(parts) != 2 || parts[0] != "Bearer" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid authorization header format"})
+		return false
+	}
 
-		c.Next()
+	claims, err := token.Parse(parts[1], secretKey)
+	if errors.Is(err, token.ErrNotValid) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token is not valid"})
+		return false
 	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+		return false
+	}
+
+	c.Set("user_id", claims["user_id"])
+	c.Set("is_admin", claims["is_admin"])
+
+	return true
+}
+
+// authenticateSession validates the access token cookie. If it is missing or
+// has expired, the session is renewed with the refresh cookie and the request
+// goes on with the new access token.
+func authenticateSession(c *gin.Context, secretKey string, cookies config.Session, refresher *session.Refresher) bool {
+	accessToken := session.AccessToken(c, cookies)
+	claims, err := token.Parse(accessToken, secretKey)
+	if accessToken == "" || errors.Is(err, token.ErrExpired) {
+		if accessToken, err = refresher.Refresh(c); err != nil {
+			if errors.Is(err, session.ErrNoSession) || status.Code(err) == codes.InvalidArgument {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has expired"})
+				return false
+			}
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Session could not be renewed", "details": err.Error()})
+			return false
+		}
+		claims, err = token.Parse(accessToken, secretKey)
+	}
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "details": err.Error()})
+		return false
+	}
+
+	c.Set("user_id", claims["user_id"])
+	c.Set("is_admin", claims["is_admin"])
+
+	return true
 }
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/etag"
+	"github.com/gin-gonic/gin"
+)
+
+// CacheMiddleware serves GET requests of the routes listed in the config from
+// the cache and marks responses with X-Cache: HIT or MISS. Successful requests
+// with any other method invalidate every entry of the namespace. basePath is
+// the version prefix the configured route paths are relative to.
+func CacheMiddleware(backend cache.Backend, namespace, basePath string, config config.Cache) gin.HandlerFunc {
+	basePath = strings.TrimSuffix(basePath, "/")
+	routes := make(map[string]int, len(config.Routes))
+	for i, route := range config.Routes {
+		routes[route.Path] = i
+	}
+
+	return func(c *gin.Context) {
+		if !config.Enabled {
+			c.Next()
+			return
+		}
+
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			if c.Writer.Status() < http.StatusBadRequest {
+				backend.DeletePrefix(namespace + ":")
+			}
+			return
+		}
+
+		i, ok := routes[strings.TrimPrefix(c.FullPath(), basePath)]
+		if !ok {
+			c.Next()
+			return
+		}
+		route := config.Routes[i]
+
+		key := cacheKey(c, namespace, route.PerUser)
+		if !strings.Contains(c.GetHeader("Cache-Control"), "no-cache") {
+			if entry, ok := backend.Get(key); ok {
+				c.Header("X-Cache", "HIT")
+				if tag := entry.Header.Get("ETag"); etag.Match(c.GetHeader("If-None-Match"), tag, true) {
+					c.Header("ETag", tag)
+					c.AbortWithStatus(http.StatusNotModified)
+					return
+				}
+				writeStored(c, entry.Status, entry.Header, entry.Body)
+				return
+			}
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Header("X-Cache", "MISS")
+
+		c.Next()
+
+		// A handler that wrote nothing failed without rendering an error, so
+		// its empty 200 isn't worth keeping.
+		if recorder.Status() != http.StatusOK || recorder.body.Len() == 0 {
+			return
+		}
+		header := storedHeader(recorder.Header())
+		header.Del("X-Cache")
+		backend.Set(key, &cache.Entry{
+			Status:    recorder.Status(),
+			Header:    header,
+			Body:      recorder.body.Bytes(),
+			ExpiresAt: time.Now().Add(route.TTL),
+		})
+	}
+}
+
+func cacheKey(c *gin.Context, namespace string, perUser bool) string {
+	var b strings.Builder
+	b.WriteString(namespace)
+	b.WriteString(":")
+	b.WriteString(c.Request.URL.Path)
+	b.WriteString("?")
+	b.WriteString(c.Request.URL.Query().Encode())
+	b.WriteString("|format=")
+	b.WriteString(codec.Negotiate(c.GetHeader("Accept")))
+	// Expanded responses depend on the rights of the user (attendees are shown to admins only).
+	if perUser || c.Query("expand") != "" {
+		b.WriteString("|user=")
+		b.WriteString(c.GetString("user_id"))
+	}
+	return b.String()
+}
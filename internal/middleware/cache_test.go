@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCacheMiddlewareInvalidation(t *testing.T) {
+	type step struct {
+		method string
+		path   string
+		// status is returned by the write handler.
+		status int
+		cache  string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"read twice", []step{
+			{http.MethodGet, "/v1/events/1", 0, "MISS"},
+			{http.MethodGet, "/v1/events/1", 0, "HIT"},
+		}},
+		{"successful write", []step{
+			{http.MethodGet, "/v1/events/1", 0, "MISS"},
+			{http.MethodPut, "/v1/events/2", http.StatusOK, ""},
+			{http.MethodGet, "/v1/events/1", 0, "MISS"},
+		}},
+		{"failed write", []step{
+			{http.MethodGet, "/v1/events/1", 0, "MISS"},
+			{http.MethodPut, "/v1/events/2", http.StatusBadRequest, ""},
+			{http.MethodGet, "/v1/events/1", 0, "HIT"},
+		}},
+		{"write through another version", []step{
+			{http.MethodGet, "/v1/events/1", 0, "MISS"},
+			{http.MethodDelete, "/events/1", http.StatusOK, ""},
+			{http.MethodGet, "/v1/events/1", 0, "MISS"},
+		}},
+		{"uncached route", []step{
+			{http.MethodGet, "/v1/events/1/users", 0, ""},
+		}},
+		{"error response", []step{
+			{http.MethodGet, "/v1/events/404", 0, "MISS"},
+			{http.MethodGet, "/v1/events/404", 0, "MISS"},
+		}},
+		{"empty response", []step{
+			{http.MethodGet, "/v1/events/empty", 0, "MISS"},
+			{http.MethodGet, "/v1/events/empty", 0, "MISS"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gin.SetMode(gin.TestMode)
+			backend := cache.NewLRU(0)
+			cacheConfig := config.Cache{
+				Enabled: true,
+				Routes:  []config.CacheRoute{{Path: "/events/:id", TTL: time.Minute}},
+			}
+
+			r := gin.New()
+			for _, group := range []*gin.RouterGroup{r.Group("v1"), r.Group("")} {
+				events := group.Group("/events")
+				events.Use(CacheMiddleware(backend, "events", group.BasePath(), cacheConfig))
+				events.GET("/:id", func(c *gin.Context) {
+					if c.Param("id") == "404" {
+						c.String(http.StatusNotFound, "not found")
+						return
+					}
+					// A handler that returns without rendering anything.
+					if c.Param("id") == "empty" {
+						return
+					}
+					c.String(http.StatusOK, c.Param("id"))
+				})
+				events.GET("/:id/users", func(c *gin.Context) { c.String(http.StatusOK, "[]") })
+				write := func(c *gin.Context) {
+					status, _ := strconv.Atoi(c.Query("status"))
+					c.Status(status)
+				}
+				events.PUT("/:id", write)
+				events.DELETE("/:id", write)
+			}
+
+			for i, s := range tt.steps {
+				path := s.path
+				if s.status != 0 {
+					path += "?status=" + strconv.Itoa(s.status)
+				}
+				w := httptest.NewRecorder()
+				r.ServeHTTP(w, httptest.NewRequest(s.method, path, nil))
+				if got := w.Header().Get("X-Cache"); got != s.cache {
+					t.Errorf("step %d: %s %s X-Cache = %q, want %q", i, s.method, s.path, got, s.cache)
+				}
+			}
+		})
+	}
+}
+
+// TestCacheMiddlewareKey checks that per-user routes are cached separately for
+// every user and that Cache-Control: no-cache skips the lookup.
+func TestCacheMiddlewareKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	backend := cache.NewLRU(0)
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("user_id", c.GetHeader("X-User")) })
+	r.Use(CacheMiddleware(backend, "events", "", config.Cache{
+		Enabled: true,
+		Routes:  []config.CacheRoute{{Path: "/events/my", TTL: time.Minute, PerUser: true}},
+	}))
+	r.GET("/events/my", func(c *gin.Context) { c.String(http.StatusOK, "events of "+c.GetString("user_id")) })
+
+	for _, s := range []struct{ user, cacheControl, cache string }{
+		{"u1", "", "MISS"},
+		{"u2", "", "MISS"},
+		{"u1", "", "HIT"},
+		{"u1", "no-cache", "MISS"},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/events/my", nil)
+		req.Header.Set("X-User", s.user)
+		req.Header.Set("Cache-Control", s.cacheControl)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if got := w.Header().Get("X-Cache"); got != s.cache {
+			t.Errorf("%s: X-Cache = %q, want %q", s.user, got, s.cache)
+		}
+		if got, want := w.Body.String(), "events of "+s.user; got != want {
+			t.Errorf("%s: body = %q, want %q", s.user, got, want)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/etag"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+	encodingZstd   = "zstd"
+)
+
+type encoder interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+type zstdEncoder struct {
+	*zstd.Encoder
+}
+
+func (e zstdEncoder) Reset(w io.Writer) {
+	e.Encoder.Reset(w)
+}
+
+var encoderPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() any {
+		w, _ := gzip.NewWriterLevel(nil, gzip.DefaultCompression)
+		return w
+	}},
+	encodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	encodingZstd: {New: func() any {
+		w, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+		return zstdEncoder{w}
+	}},
+}
+
+type decoder interface {
+	io.Reader
+	Reset(r io.Reader) error
+}
+
+type brotliDecoder struct {
+	*brotli.Reader
+}
+
+func (d brotliDecoder) Reset(r io.Reader) error {
+	return d.Reader.Reset(r)
+}
+
+var decoderPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() any {
+		return new(gzip.Reader)
+	}},
+	encodingBrotli: {New: func() any {
+		return brotliDecoder{brotli.NewReader(nil)}
+	}},
+	encodingZstd: {New: func() any {
+		d, _ := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		return d
+	}},
+}
+
+// CompressionMiddleware decompresses gzip, brotli and zstd request bodies and
+// compresses responses with the best encoding accepted by the client. Only
+// responses with an allowed content type and at least MinSize bytes are
+// compressed; encoders and decoders are pooled.
+func CompressionMiddleware(config config.Compression) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.Enabled {
+			c.Next()
+			return
+		}
+
+		if encoding := strings.ToLower(c.GetHeader("Content-Encoding")); encoding != "" && encoding != "identity" {
+			pool, ok := decoderPools[encoding]
+			if !ok {
+				c.AbortWithStatusJSON(
+					http.StatusUnsupportedMediaType,
+					gin.H{
+						"code":    http.StatusUnsupportedMediaType,
+						"message": "Content-Encoding is not supported",
+					},
+				)
+				return
+			}
+			dec := pool.Get().(decoder)
+			if err := dec.Reset(c.Request.Body); err != nil {
+				c.AbortWithStatusJSON(
+					http.StatusBadRequest,
+					gin.H{
+						"code":    http.StatusBadRequest,
+						"message": "Body can't be decompressed",
+					},
+				)
+				return
+			}
+			defer pool.Put(dec)
+
+			c.Request.Body = http.MaxBytesReader(c.Writer, io.NopCloser(dec), config.MaxRequestSize)
+			c.Request.Header.Del("Content-Encoding")
+			c.Request.Header.Del("Content-Length")
+			c.Request.ContentLength = -1
+		}
+
+		// Compressed responses carry tags of their own, which the handlers
+		// don't know, so preconditions are checked on the unencoded ones.
+		ifNoneMatch := c.GetHeader("If-None-Match")
+		for _, name := range []string{"If-Match", "If-None-Match"} {
+			if v := c.GetHeader(name); v != "" {
+				c.Request.Header.Set(name, etag.WithoutEncoding(v))
+			}
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"), config.Encodings)
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		writer := &compressWriter{
+			ResponseWriter: c.Writer,
+			config:         config,
+			encoding:       encoding,
+			ifNoneMatch:    ifNoneMatch,
+		}
+		c.Writer = writer
+		defer writer.close()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the supported encoding with the highest q-value in
+// Accept-Encoding; ties are resolved by the order of preferred.
+func negotiateEncoding(header string, preferred []string) string {
+	if header == "" {
+		return ""
+	}
+
+	weights := make(map[string]float64)
+	wildcard := -1.0
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		if name == "*" {
+			wildcard = q
+			continue
+		}
+		weights[name] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range preferred {
+		if _, ok := encoderPools[encoding]; !ok {
+			continue
+		}
+		q, ok := weights[encoding]
+		if !ok {
+			q = wildcard
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the beginning of the response until it knows whether
+// the response is worth compressing, then streams it through a pooled encoder.
+type compressWriter struct {
+	gin.ResponseWriter
+	config   config.Compression
+	encoding string
+	// ifNoneMatch is the header as sent, with the tags of encoded responses.
+	ifNoneMatch string
+	buf         []byte
+	encoder     encoder
+	decided     bool
+}
+
+func (w *compressWriter) WriteHeaderNow() {
+	if w.decided {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.config.MinSize {
+		w.decide(false)
+		if err := w.flushBuffer(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(false)
+		w.flushBuffer()
+	}
+	if w.encoder != nil {
+		w.encoder.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+func (w *compressWriter) decide(final bool) {
+	w.decided = true
+
+	header := w.Header()
+	status := w.Status()
+	// A 304 repeats the tag of the representation the client has cached.
+	if tag := header.Get("ETag"); status == http.StatusNotModified && tag != "" {
+		if encoded := etag.WithEncoding(tag, w.encoding); etag.Match(w.ifNoneMatch, encoded, true) {
+			header.Set("ETag", encoded)
+		}
+	}
+	if !w.compressible(header.Get("Content-Type")) {
+		return
+	}
+	addVary(header, "Accept-Encoding")
+
+	if header.Get("Content-Encoding") != "" ||
+		status == http.StatusNoContent || status == http.StatusNotModified ||
+		(final && len(w.buf) < w.config.MinSize) {
+		return
+	}
+
+	header.Set("Content-Encoding", w.encoding)
+	header.Del("Content-Length")
+	if tag := header.Get("ETag"); tag != "" {
+		header.Set("ETag", etag.WithEncoding(tag, w.encoding))
+	}
+	w.encoder = encoderPools[w.encoding].Get().(encoder)
+	w.encoder.Reset(w.ResponseWriter)
+}
+
+func (w *compressWriter) compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	return mediaType != "" && slices.Contains(w.config.ContentTypes, mediaType)
+}
+
+func (w *compressWriter) flushBuffer() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	var err error
+	if w.encoder != nil {
+		_, err = w.encoder.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+func (w *compressWriter) close() {
+	if !w.decided {
+		w.decide(true)
+	}
+	w.flushBuffer()
+	if w.encoder != nil {
+		w.encoder.Close()
+		w.encoder.Reset(io.Discard)
+		encoderPools[w.encoding].Put(w.encoder)
+		w.encoder = nil
+		return
+	}
+	w.ResponseWriter.WriteHeaderNow()
+}
+
+func addVary(header http.Header, value string) {
+	for _, v := range header.Values("Vary") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), value) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", value)
+}
@@ -0,0 +1,242 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/etag"
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	preferred := []string{encodingZstd, encodingBrotli, encodingGzip}
+
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", encodingGzip},
+		{"gzip, br", encodingBrotli},
+		{"gzip, br, zstd", encodingZstd},
+		{"GZIP", encodingGzip},
+		{"br;q=0.5, gzip", encodingGzip},
+		{"br;q=0.5, gzip;q=0.5", encodingBrotli},
+		{"zstd;q=0, gzip;q=0.1", encodingGzip},
+		{"*", encodingZstd},
+		{"*;q=0.1, br;q=0.2", encodingBrotli},
+		{"*, zstd;q=0", encodingBrotli},
+		{"deflate, compress", ""},
+	}
+	for _, tt := range tests {
+		if got := negotiateEncoding(tt.header, preferred); got != tt.want {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", tt.header, got, tt.want)
+		}
+	}
+
+	if got := negotiateEncoding("zstd, gzip", []string{encodingGzip, "deflate"}); got != encodingGzip {
+		t.Errorf("negotiateEncoding() with gzip configured = %q, want %q", got, encodingGzip)
+	}
+}
+
+func compressionRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CompressionMiddleware(config.Compression{
+		Enabled:        true,
+		MinSize:        64,
+		Encodings:      []string{encodingZstd, encodingBrotli, encodingGzip},
+		ContentTypes:   []string{"application/json"},
+		MaxRequestSize: 1 << 10,
+	}))
+	r.GET("/json", func(c *gin.Context) {
+		c.Data(http.StatusOK, "application/json", []byte(c.Query("body")))
+	})
+	r.GET("/csv", func(c *gin.Context) {
+		c.Data(http.StatusOK, "text/csv", []byte(c.Query("body")))
+	})
+	r.GET("/tagged", func(c *gin.Context) {
+		c.Header("ETag", `"abc.json"`)
+		if etag.Match(c.GetHeader("If-None-Match"), `"abc.json"`, true) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		c.Data(http.StatusOK, "application/json", []byte(c.Query("body")))
+	})
+	r.POST("/echo", func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.Status(http.StatusRequestEntityTooLarge)
+			return
+		}
+		c.Data(http.StatusOK, "text/plain", body)
+	})
+	return r
+}
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	switch encoding {
+	case "":
+		return string(body)
+	case encodingGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	case encodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	case encodingZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestCompressionMiddlewareResponse(t *testing.T) {
+	r := compressionRouter()
+	large := `{"title":"` + strings.Repeat("go ", 50) + `"}`
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		acceptEncoding string
+		encoding       string
+		vary           bool
+	}{
+		{"gzip", "/json", large, "gzip", encodingGzip, true},
+		{"brotli", "/json", large, "gzip, br", encodingBrotli, true},
+		{"zstd", "/json", large, "gzip, br, zstd", encodingZstd, true},
+		{"not accepted", "/json", large, "", "", false},
+		{"below min size", "/json", `{"id":1}`, "gzip", "", true},
+		{"content type not listed", "/csv", large, "gzip", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path+"?body="+url.QueryEscape(tt.body), nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding != tt.encoding {
+				t.Fatalf("Content-Encoding = %q, want %q", encoding, tt.encoding)
+			}
+			if got := w.Header().Get("Vary") == "Accept-Encoding"; got != tt.vary {
+				t.Errorf("Vary = %q, want Accept-Encoding: %v", w.Header().Get("Vary"), tt.vary)
+			}
+			if encoding != "" && w.Header().Get("Content-Length") != "" {
+				t.Error("compressed response has a Content-Length")
+			}
+			if got := decompress(t, encoding, w.Body.Bytes()); got != tt.body {
+				t.Errorf("body = %q, want %q", got, tt.body)
+			}
+		})
+	}
+}
+
+// TestCompressionMiddlewareETag checks that compressed responses get tags of
+// their own and that conditional requests with them still reach a 304.
+func TestCompressionMiddlewareETag(t *testing.T) {
+	r := compressionRouter()
+	large := `{"title":"` + strings.Repeat("go ", 50) + `"}`
+
+	tests := []struct {
+		name           string
+		body           string
+		acceptEncoding string
+		ifNoneMatch    string
+		status         int
+		etag           string
+	}{
+		{"compressed", large, "gzip", "", http.StatusOK, `"abc.json+gzip"`},
+		{"not compressed", large, "", "", http.StatusOK, `"abc.json"`},
+		{"below min size", `{"id":1}`, "gzip", "", http.StatusOK, `"abc.json"`},
+		{"compressed tag", large, "gzip", `"abc.json+gzip"`, http.StatusNotModified, `"abc.json+gzip"`},
+		{"uncompressed tag", `{"id":1}`, "gzip", `"abc.json"`, http.StatusNotModified, `"abc.json"`},
+		{"other tag", large, "gzip", `"def.json+gzip"`, http.StatusOK, `"abc.json+gzip"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/tagged?body="+url.QueryEscape(tt.body), nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+			if got := w.Header().Get("ETag"); got != tt.etag {
+				t.Errorf("ETag = %s, want %s", got, tt.etag)
+			}
+		})
+	}
+}
+
+func TestCompressionMiddlewareRequest(t *testing.T) {
+	r := compressionRouter()
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte("hello"))
+	zw.Close()
+
+	var bomb bytes.Buffer
+	zw = gzip.NewWriter(&bomb)
+	zw.Write(make([]byte, 1<<20))
+	zw.Close()
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		status   int
+		echo     string
+	}{
+		{"plain", "", []byte("hello"), http.StatusOK, "hello"},
+		{"identity", "identity", []byte("hello"), http.StatusOK, "hello"},
+		{"gzip", "gzip", gz.Bytes(), http.StatusOK, "hello"},
+		{"unsupported", "deflate", []byte("hello"), http.StatusUnsupportedMediaType, ""},
+		{"corrupt", "gzip", []byte("hello"), http.StatusBadRequest, ""},
+		{"over max size once decompressed", "gzip", bomb.Bytes(), http.StatusRequestEntityTooLarge, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(tt.body))
+			if tt.encoding != "" {
+				req.Header.Set("Content-Encoding", tt.encoding)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.echo != "" && w.Body.String() != tt.echo {
+				t.Errorf("body = %q, want %q", w.Body, tt.echo)
+			}
+		})
+	}
+}
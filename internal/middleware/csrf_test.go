@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Session{
+		Enabled:       true,
+		AccessCookie:  "access_token",
+		RefreshCookie: "refresh_token",
+		CSRFCookie:    "csrf_token",
+		CSRFHeader:    "X-CSRF-Token",
+	}
+	r := gin.New()
+	r.Use(CSRFMiddleware(cfg))
+	r.Any("/events/", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	session := []*http.Cookie{
+		{Name: "access_token", Value: "a"},
+		{Name: "csrf_token", Value: "t"},
+	}
+	tests := []struct {
+		name          string
+		method        string
+		cookies       []*http.Cookie
+		csrf          string
+		authorization string
+		status        int
+	}{
+		{"safe method", http.MethodGet, session, "", "", http.StatusNoContent},
+		{"no session", http.MethodPost, nil, "", "", http.StatusNoContent},
+		{"bearer token", http.MethodPost, session, "", "Bearer x", http.StatusNoContent},
+		{"matching token", http.MethodPost, session, "t", "", http.StatusNoContent},
+		{"missing token", http.MethodDelete, session, "", "", http.StatusForbidden},
+		{"wrong token", http.MethodPut, session, "u", "", http.StatusForbidden},
+		{"refresh cookie only", http.MethodPost, []*http.Cookie{{Name: "refresh_token", Value: "r"}}, "", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/events/", nil)
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			if tt.csrf != "" {
+				req.Header.Set("X-CSRF-Token", tt.csrf)
+			}
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
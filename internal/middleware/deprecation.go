@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// DeprecationMiddleware marks responses of routes being retired with
+// Deprecation (RFC 9745), Sunset (RFC 8594) and Link headers.
+func DeprecationMiddleware(deprecations []config.Deprecation) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		for _, d := range deprecations {
+			// Prefixes may be configured with a trailing slash, which would
+			// otherwise be cut from the successor path.
+			prefix := strings.TrimSuffix(d.Prefix, "/")
+			if !hasPathPrefix(path, prefix) {
+				continue
+			}
+			if !d.Date.IsZero() {
+				c.Header("Deprecation", fmt.Sprintf("@%d", d.Date.Unix()))
+			}
+			if !d.Sunset.IsZero() {
+				c.Header("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+			}
+			if d.Link != "" {
+				c.Writer.Header().Add("Link", fmt.Sprintf(`<%s>; rel="deprecation"`, d.Link))
+			}
+			if d.Successor != "" {
+				successor := strings.TrimSuffix(d.Successor, "/") + strings.TrimPrefix(path, prefix)
+				c.Writer.Header().Add("Link", fmt.Sprintf(`<%s>; rel="successor-version"`, successor))
+			}
+			break
+		}
+		c.Next()
+	}
+}
+
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
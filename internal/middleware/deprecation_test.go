@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestDeprecationMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deprecations := []config.Deprecation{
+		{
+			Prefix:    "/events",
+			Successor: "/v1/events",
+			Date:      time.Date(2026, 10, 19, 0, 0, 0, 0, time.UTC),
+			Sunset:    time.Date(2027, 4, 1, 0, 0, 0, 0, time.UTC),
+			Link:      "https://example.com/versioning",
+		},
+		{Prefix: "/auth", Successor: "/v1/auth"},
+		{Prefix: "/webhooks/", Successor: "/v1/webhooks/"},
+	}
+
+	r := gin.New()
+	r.Use(DeprecationMiddleware(deprecations))
+	r.NoRoute(func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	tests := []struct {
+		name        string
+		path        string
+		deprecation string
+		sunset      string
+		links       []string
+	}{
+		{
+			name:        "deprecated alias",
+			path:        "/events/5/users",
+			deprecation: "@1792368000",
+			sunset:      "Thu, 01 Apr 2027 00:00:00 GMT",
+			links: []string{
+				`<https://example.com/versioning>; rel="deprecation"`,
+				`</v1/events/5/users>; rel="successor-version"`,
+			},
+		},
+		{
+			name:        "prefix itself",
+			path:        "/events",
+			deprecation: "@1792368000",
+			sunset:      "Thu, 01 Apr 2027 00:00:00 GMT",
+			links: []string{
+				`<https://example.com/versioning>; rel="deprecation"`,
+				`</v1/events>; rel="successor-version"`,
+			},
+		},
+		{
+			name:  "only successor configured",
+			path:  "/auth/login",
+			links: []string{`</v1/auth/login>; rel="successor-version"`},
+		},
+		{
+			name:  "prefix with trailing slash",
+			path:  "/webhooks/3/deliveries",
+			links: []string{`</v1/webhooks/3/deliveries>; rel="successor-version"`},
+		},
+		{
+			name:  "prefix with trailing slash itself",
+			path:  "/webhooks",
+			links: []string{`</v1/webhooks>; rel="successor-version"`},
+		},
+		{name: "versioned route", path: "/v1/events/5"},
+		{name: "shared prefix of another segment", path: "/eventsource"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if got := w.Header().Get("Deprecation"); got != tt.deprecation {
+				t.Errorf("Deprecation = %q, want %q", got, tt.deprecation)
+			}
+			if got := w.Header().Get("Sunset"); got != tt.sunset {
+				t.Errorf("Sunset = %q, want %q", got, tt.sunset)
+			}
+			if got := w.Header().Values("Link"); !slices.Equal(got, tt.links) {
+				t.Errorf("Link = %q, want %q", got, tt.links)
+			}
+		})
+	}
+}
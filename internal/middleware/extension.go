@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExtensionMiddleware serves GET requests whose path parameter ends with ext
+// (e.g. /events/1.ics, which gin routes to /events/:id) with handlers instead
+// of the rest of the route chain. The extension is stripped from the
+// parameter. The handlers must not call c.Next.
+func ExtensionMiddleware(param, ext string, handlers ...gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet {
+			c.Next()
+			return
+		}
+		value, ok := strings.CutSuffix(c.Param(param), ext)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		for i := range c.Params {
+			if c.Params[i].Key == param {
+				c.Params[i].Value = value
+			}
+		}
+		for _, handler := range handlers {
+			if handler(c); c.IsAborted() {
+				return
+			}
+		}
+		c.Abort()
+	}
+}
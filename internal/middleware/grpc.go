@@ -0,0 +1,196 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/rpc"
+	"github.com/Estriper0/eventhub_gateway/internal/token"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// The interceptors below are the gRPC counterparts of the HTTP middleware and
+// are chained in the same order.
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	userIDKey
+	isAdminKey
+	apiKeyCtxKey
+)
+
+// RequestID returns the request ID set by UUIDInterceptor.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// User returns the user authenticated by JWTAuthInterceptor or
+// APIKeyInterceptor.
+func User(ctx context.Context) (userID string, isAdmin bool) {
+	userID, _ = ctx.Value(userIDKey).(string)
+	isAdmin, _ = ctx.Value(isAdminKey).(bool)
+	return userID, isAdmin
+}
+
+func RecoveryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.Error(fmt.Sprintf("Panic recovered: %v", r))
+				err = status.Error(codes.Internal, "Something went wrong!")
+			}
+		}()
+		return handler(ctx, req)
+	}
+}
+
+// RateLimiterInterceptor limits calls by peer IP, or by the tier of a valid
+// API key like RateLimiterMiddleware.
+func RateLimiterInterceptor(config *config.Config, verifier *apikey.Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var ip string
+		if p, ok := peer.FromContext(ctx); ok {
+			ip = p.Addr.String()
+			if host, _, err := net.SplitHostPort(ip); err == nil {
+				ip = host
+			}
+		}
+		limiter := getClientLimiter(ip, config)
+		if raw := apiKeyMetadata(ctx, config.APIKeys); raw != "" && config.APIKeys.Enabled {
+			if key, err := verifier.Verify(raw); err == nil {
+				limiter = getKeyLimiter(key, config.APIKeys)
+				ctx = context.WithValue(ctx, apiKeyCtxKey, key)
+			}
+		}
+		if !limiter.Allow() {
+			return nil, status.Error(codes.ResourceExhausted, "Too many requests")
+		}
+		return handler(ctx, req)
+	}
+}
+
+func UUIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		requestID := uuid.New().String()
+
+		ctx = context.WithValue(ctx, requestIDKey, requestID)
+		grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestID))
+
+		return handler(ctx, req)
+	}
+}
+
+func LoggerInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		t := time.Now()
+		resp, err := handler(ctx, req)
+		code := status.Code(err)
+
+		attrs := []any{
+			slog.String("request_id", RequestID(ctx)),
+			slog.String("uri", info.FullMethod),
+			slog.Float64("time", time.Since(t).Seconds()),
+			slog.String("status", code.String()),
+		}
+		if s := rpc.HTTPStatus(code); s >= http.StatusInternalServerError {
+			logger.Error("End of request with server error", attrs...)
+		} else if s >= http.StatusBadRequest {
+			logger.Warn("End of request with user error", attrs...)
+		} else {
+			logger.Info("End of request", attrs...)
+		}
+		return resp, err
+	}
+}
+
+// JWTAuthInterceptor validates the Bearer access token in the authorization
+// metadata of the methods for which authenticated returns true.
+func JWTAuthInterceptor(secretKey string, authenticated func(method string) bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if !authenticated(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get("authorization")
+		if len(values) == 0 {
+			return nil, status.Error(codes.Unauthenticated, "Authorization metadata is required")
+		}
+
+		parts := strings.Split(values[0], " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			return nil, status.Error(codes.Unauthenticated, "Invalid authorization metadata format")
+		}
+
+		claims, err := token.Parse(parts[1], secretKey)
+		if errors.Is(err, token.ErrNotValid) {
+			return nil, status.Error(codes.Unauthenticated, "Token is not valid")
+		}
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, fmt.Sprintf("Invalid token: %s", err))
+		}
+
+		ctx = context.WithValue(ctx, userIDKey, claims["user_id"])
+		ctx = context.WithValue(ctx, isAdminKey, claims["is_admin"])
+
+		return handler(ctx, req)
+	}
+}
+
+// APIKeyInterceptor authenticates calls of the methods for which
+// authenticated returns true with an API key in the metadata named after
+// api_keys.header, e.g. x-api-key. Keys need the "rpc:write" scope, as calls
+// of /rpc do. Calls without a key are handed to next, usually
+// JWTAuthInterceptor.
+func APIKeyInterceptor(verifier *apikey.Verifier, keys config.APIKeys, authenticated func(method string) bool, next grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		raw := apiKeyMetadata(ctx, keys)
+		if raw == "" || !authenticated(info.FullMethod) {
+			return next(ctx, req, info, handler)
+		}
+
+		key, ok := ctx.Value(apiKeyCtxKey).(*apikey.Key)
+		if !ok {
+			var err error
+			key, err = verifier.Verify(raw)
+			if errors.Is(err, apikey.ErrInvalid) || errors.Is(err, apikey.ErrExpired) {
+				return nil, status.Error(codes.Unauthenticated, err.Error())
+			}
+			if err != nil {
+				return nil, status.Error(codes.Internal, "Internal error")
+			}
+		}
+		if !key.Allows("rpc:write") {
+			return nil, status.Error(codes.PermissionDenied, "API key lacks the rpc:write scope")
+		}
+
+		ctx = context.WithValue(ctx, userIDKey, key.Owner)
+		ctx = context.WithValue(ctx, isAdminKey, key.Allows(apikey.ScopeAdmin))
+
+		return handler(ctx, req)
+	}
+}
+
+func apiKeyMetadata(ctx context.Context, keys config.APIKeys) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(keys.Header); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader = "Idempotency-Key"
+	maxIdempotencyKeyLen = 255
+	idempotencyPollDelay = 50 * time.Millisecond
+)
+
+// IdempotencyMiddleware replays the stored response for requests retried with
+// the same Idempotency-Key. Keys are scoped by user, reusing a key with a
+// different request is rejected with 422, and concurrent duplicates wait for
+// the first request to finish. Server errors and empty responses, such as
+// those of handlers that return without rendering, are not stored, so the
+// request can be retried with the same key.
+func IdempotencyMiddleware(store idempotency.Store, config config.Idempotency) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{
+					"code":    http.StatusBadRequest,
+					"message": "Idempotency-Key is too long",
+				},
+			)
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{
+					"code":    http.StatusBadRequest,
+					"message": "Body can't be read",
+				},
+			)
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		storeKey := c.GetString("user_id") + ":" + key
+		fingerprint := requestFingerprint(c, body)
+
+		deadline := time.Now().Add(config.WaitTimeout)
+		for {
+			record, locked, err := store.Lock(storeKey, fingerprint, config.TTL)
+			if err != nil {
+				c.AbortWithStatusJSON(
+					http.StatusInternalServerError,
+					gin.H{
+						"code":    http.StatusInternalServerError,
+						"message": "Internal error",
+					},
+				)
+				return
+			}
+			if locked {
+				break
+			}
+
+			if record.Fingerprint != fingerprint {
+				c.AbortWithStatusJSON(
+					http.StatusUnprocessableEntity,
+					gin.H{
+						"code":    http.StatusUnprocessableEntity,
+						"message": "Idempotency-Key was already used with a different request",
+					},
+				)
+				return
+			}
+			if record.Response != nil {
+				c.Header("Idempotent-Replayed", "true")
+				writeStored(c, record.Response.Status, record.Response.Header, record.Response.Body)
+				return
+			}
+
+			if time.Now().After(deadline) {
+				c.AbortWithStatusJSON(
+					http.StatusConflict,
+					gin.H{
+						"code":    http.StatusConflict,
+						"message": "A request with this Idempotency-Key is still being processed",
+					},
+				)
+				return
+			}
+			select {
+			case <-c.Request.Context().Done():
+				c.Abort()
+				return
+			case <-time.After(idempotencyPollDelay):
+			}
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		saved := false
+		defer func() {
+			if !saved {
+				store.Unlock(storeKey)
+			}
+		}()
+
+		c.Next()
+
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError || recorder.body.Len() == 0 {
+			return
+		}
+		response := &idempotency.Response{
+			Status: status,
+			Header: storedHeader(recorder.Header()),
+			Body:   recorder.body.Bytes(),
+		}
+		if err := store.Save(storeKey, response, config.TTL); err == nil {
+			saved = true
+		}
+	}
+}
+
+func requestFingerprint(c *gin.Context, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(c.Request.Method + "\n" + c.Request.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
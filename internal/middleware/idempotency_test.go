@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/idempotency"
+	"github.com/gin-gonic/gin"
+)
+
+// idempotencyRouter serves POST /events/ with a handler that counts its
+// calls and answers with the given status, or writes nothing if it is zero.
+func idempotencyRouter(status *atomic.Int32, calls *atomic.Int32, delay time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", c.GetHeader("X-User"))
+		c.Next()
+	})
+	r.Use(IdempotencyMiddleware(idempotency.NewMemoryStore(), config.Idempotency{
+		TTL:         time.Minute,
+		WaitTimeout: time.Second,
+	}))
+	r.POST("/events/", func(c *gin.Context) {
+		n := calls.Add(1)
+		time.Sleep(delay)
+		c.Header("X-Call", strconv.Itoa(int(n)))
+		if status.Load() == 0 {
+			return
+		}
+		c.JSON(int(status.Load()), gin.H{"id": n})
+	})
+	return r
+}
+
+func postEvent(r http.Handler, user, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/events/", strings.NewReader(body))
+	req.Header.Set("X-User", user)
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusCreated)
+	r := idempotencyRouter(&status, &calls, 0)
+
+	first := postEvent(r, "u1", "k1", `{"title":"Go"}`)
+	replayed := postEvent(r, "u1", "k1", `{"title":"Go"}`)
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+	if replayed.Code != first.Code || replayed.Body.String() != first.Body.String() {
+		t.Errorf("replay = %d %s, want %d %s", replayed.Code, replayed.Body, first.Code, first.Body)
+	}
+	if replayed.Header().Get("X-Call") != "1" {
+		t.Errorf("replayed X-Call = %q, want the stored header", replayed.Header().Get("X-Call"))
+	}
+	if replayed.Header().Get("Idempotent-Replayed") != "true" {
+		t.Error("replay has no Idempotent-Replayed header")
+	}
+	if first.Header().Get("Idempotent-Replayed") != "" {
+		t.Error("first response is marked as replayed")
+	}
+
+	// Keys are scoped by user and requests without a key always run.
+	postEvent(r, "u2", "k1", `{"title":"Go"}`)
+	postEvent(r, "u1", "", `{"title":"Go"}`)
+	if calls.Load() != 3 {
+		t.Errorf("handler called %d times, want 3", calls.Load())
+	}
+}
+
+func TestIdempotencyRejectsReuse(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusCreated)
+	r := idempotencyRouter(&status, &calls, 0)
+
+	postEvent(r, "u1", "k1", `{"title":"Go"}`)
+	if w := postEvent(r, "u1", "k1", `{"title":"Rust"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body: status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+	if w := postEvent(r, "u1", strings.Repeat("k", maxIdempotencyKeyLen+1), `{}`); w.Code != http.StatusBadRequest {
+		t.Errorf("long key: status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("handler called %d times, want 1", calls.Load())
+	}
+}
+
+func TestIdempotencyServerErrorNotStored(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusBadGateway)
+	r := idempotencyRouter(&status, &calls, 0)
+
+	if w := postEvent(r, "u1", "k1", `{}`); w.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+	status.Store(http.StatusCreated)
+	if w := postEvent(r, "u1", "k1", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry = %d replayed %q, want a fresh %d", w.Code, w.Header().Get("Idempotent-Replayed"), http.StatusCreated)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, want 2", calls.Load())
+	}
+}
+
+func TestIdempotencyEmptyResponseNotStored(t *testing.T) {
+	var status, calls atomic.Int32
+	r := idempotencyRouter(&status, &calls, 0)
+
+	postEvent(r, "u1", "k1", `{}`)
+	status.Store(http.StatusCreated)
+	if w := postEvent(r, "u1", "k1", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry = %d replayed %q, want a fresh %d", w.Code, w.Header().Get("Idempotent-Replayed"), http.StatusCreated)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("handler called %d times, want 2", calls.Load())
+	}
+}
+
+func TestIdempotencyConcurrentDuplicates(t *testing.T) {
+	var status, calls atomic.Int32
+	status.Store(http.StatusCreated)
+	r := idempotencyRouter(&status, &calls, 100*time.Millisecond)
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 4)
+	for i := range responses {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			responses[i] = postEvent(r, "u1", "k1", `{}`)
+		}()
+	}
+	wg.Wait()
+
+	if calls.Load() != 1 {
+		t.Fatalf("handler called %d times, want 1", calls.Load())
+	}
+	for i, w := range responses {
+		if w.Code != http.StatusCreated || w.Body.String() != responses[0].Body.String() {
+			t.Errorf("response %d = %d %s", i, w.Code, w.Body)
+		}
+	}
+}
@@ -5,34 +5,78 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
 	"github.com/Estriper0/eventhub_gateway/internal/config"
 	"github.com/gin-gonic/gin"
 	"golang.org/x/time/rate"
 )
 
+// limiterIdle is how long a limiter is kept without requests. A limiter
+// allowing n requests per minute with a burst of n is full again after a
+// minute, so dropping it then doesn't change what its client is allowed.
+const limiterIdle = time.Minute
+
 type Client struct {
-	limiter *rate.Limiter
+	limiter  *rate.Limiter
+	lastSeen time.Time
 }
 
 var clients = make(map[string]*Client)
+var lastSweep time.Time
 var mu sync.Mutex
 
 func getClientLimiter(ip string, config *config.Config) *rate.Limiter {
+	return getLimiter(ip, config.RequestPerMinute)
+}
+
+// getKeyLimiter returns the limiter of an API key, sized by its tier.
+func getKeyLimiter(key *apikey.Key, keys config.APIKeys) *rate.Limiter {
+	perMinute, ok := keys.Tiers[key.Tier]
+	if !ok {
+		perMinute = keys.Tiers[keys.DefaultTier]
+	}
+	return getLimiter("api_key:"+key.ID, perMinute)
+}
+
+func getLimiter(key string, perMinute int) *rate.Limiter {
 	mu.Lock()
 	defer mu.Unlock()
 
-	if client, ok := clients[ip]; ok {
+	now := time.Now()
+	if now.Sub(lastSweep) >= limiterIdle {
+		for k, client := range clients {
+			if now.Sub(client.lastSeen) >= limiterIdle {
+				delete(clients, k)
+			}
+		}
+		lastSweep = now
+	}
+
+	if client, ok := clients[key]; ok {
+		client.lastSeen = now
 		return client.limiter
 	}
 
-	limiter := rate.NewLimiter(rate.Every(time.Minute), config.RequestPerMinute)
-	clients[ip] = &Client{limiter: limiter}
+	limiter := rate.NewLimiter(rate.Limit(float64(perMinute)/60), perMinute)
+	clients[key] = &Client{limiter: limiter, lastSeen: now}
 	return limiter
 }
 
-func RateLimiterMiddleware(config *config.Config) gin.HandlerFunc {
+// RateLimiterMiddleware limits requests by client IP. Requests with a valid
+// API key are limited by the tier of the key instead, so that partners
+// sharing an address don't share its limit; the verified key is kept for
+// APIKeyMiddleware. Invalid keys count against the address.
+func RateLimiterMiddleware(config *config.Config, verifier *apikey.Verifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		limiter := getClientLimiter(c.Request.RemoteAddr, config)
+		// The IP of the connection, as X-Forwarded-For can be set by anyone
+		// and a port would give every connection a limit of its own.
+		limiter := getClientLimiter(c.RemoteIP(), config)
+		if raw := c.GetHeader(config.APIKeys.Header); raw != "" && config.APIKeys.Enabled {
+			if key, err := verifier.Verify(raw); err == nil {
+				limiter = getKeyLimiter(key, config.APIKeys)
+				c.Set(apiKeyKey, key)
+			}
+		}
 		if !limiter.Allow() {
 			c.JSON(http.StatusTooManyRequests, gin.H{"message": "Too many requests"})
 			c.Abort()
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// TestRateLimiterMiddleware checks that the limit is shared by the
+// connections of an address and allows a burst of a minute's requests.
+func TestRateLimiterMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RateLimiterMiddleware(&config.Config{RequestPerMinute: 3}, nil))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i, s := range []struct {
+		remoteAddr string
+		status     int
+	}{
+		{"192.0.2.1:1001", http.StatusOK},
+		{"192.0.2.1:1002", http.StatusOK},
+		{"192.0.2.1:1003", http.StatusOK},
+		{"192.0.2.1:1004", http.StatusTooManyRequests},
+		{"192.0.2.2:1001", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = s.remoteAddr
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != s.status {
+			t.Errorf("request %d from %s: status = %d, want %d", i, s.remoteAddr, w.Code, s.status)
+		}
+	}
+}
+
+func TestGetLimiterEvictsIdle(t *testing.T) {
+	limiter := getLimiter("evict-test", 60)
+	if got := limiter.Burst(); got != 60 {
+		t.Errorf("burst = %d, want 60", got)
+	}
+	if got := float64(limiter.Limit()); got != 1 {
+		t.Errorf("limit = %v per second, want 1", got)
+	}
+
+	mu.Lock()
+	clients["evict-test"].lastSeen = time.Now().Add(-limiterIdle)
+	lastSweep = time.Time{}
+	mu.Unlock()
+
+	if getLimiter("other", 60); getLimiter("evict-test", 60) == limiter {
+		t.Error("idle limiter was not evicted")
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bodyRecorder passes the response through while keeping a copy of its body.
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// writeStored writes a previously recorded response and aborts the chain.
+func writeStored(c *gin.Context, status int, header http.Header, body []byte) {
+	for name, values := range header {
+		c.Writer.Header()[name] = values
+	}
+	c.Data(status, header.Get("Content-Type"), body)
+	c.Abort()
+}
+
+// storedHeader returns a copy of the response header without the fields that
+// belong to a particular transfer of the response.
+func storedHeader(header http.Header) http.Header {
+	stored := header.Clone()
+	stored.Del("X-Request-ID")
+	stored.Del("Content-Encoding")
+	stored.Del("Content-Length")
+	return stored
+}
@@ -0,0 +1,166 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Estriper0/eventhub_gateway/internal/codec"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	openapi3filter.RegisterBodyDecoder(codec.MIMEMsgpack, msgpackBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(codec.MIMEMsgpack2, msgpackBodyDecoder)
+	// Protobuf bodies are opaque to the schema; the upstream service validates them.
+	openapi3filter.RegisterBodyDecoder(codec.MIMEProtobuf, openapi3filter.FileBodyDecoder)
+	openapi3filter.RegisterBodyDecoder(codec.MIMEProtobuf2, openapi3filter.FileBodyDecoder)
+}
+
+type FieldError struct {
+	Location string `json:"location"`
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+}
+
+// ValidationMiddleware checks path, query and body of the request against the
+// operation described in the OpenAPI document. basePath is the version prefix
+// of the route group (e.g. /v1) that the document paths are relative to.
+// Routes that are not described in the document are passed through untouched.
+func ValidationMiddleware(doc *openapi3.T, basePath string) gin.HandlerFunc {
+	basePath = strings.TrimSuffix(basePath, "/")
+
+	options := &openapi3filter.Options{
+		MultiError:         true,
+		AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(c *gin.Context) {
+		path := openAPIPath(strings.TrimPrefix(c.FullPath(), basePath))
+		pathItem := doc.Paths.Value(path)
+		if pathItem == nil {
+			c.Next()
+			return
+		}
+		operation := pathItem.GetOperation(c.Request.Method)
+		if operation == nil {
+			c.Next()
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+
+		if operation.RequestBody != nil && c.GetHeader("Content-Type") == "" {
+			c.Request.Header.Set("Content-Type", gin.MIMEJSON)
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: params,
+			Route: &routers.Route{
+				Spec:      doc,
+				Path:      path,
+				PathItem:  pathItem,
+				Method:    c.Request.Method,
+				Operation: operation,
+			},
+			Options: options,
+		}
+
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{
+					"code":    http.StatusBadRequest,
+					"message": "Request validation failed",
+					"errors":  validationErrors(err),
+				},
+			)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// openAPIPath converts a gin route template (/events/:id) to the OpenAPI one (/events/{id}).
+func openAPIPath(fullPath string) string {
+	segments := strings.Split(fullPath, "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func validationErrors(err error) []FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var result []FieldError
+		for _, inner := range e {
+			result = append(result, validationErrors(inner)...)
+		}
+		return result
+	case *openapi3filter.RequestError:
+		location, field := "body", ""
+		if e.Parameter != nil {
+			location, field = e.Parameter.In, e.Parameter.Name
+		}
+		if e.Err == nil {
+			return []FieldError{{Location: location, Field: field, Message: e.Reason}}
+		}
+		return fieldErrors(location, field, e.Reason, e.Err)
+	}
+	return []FieldError{{Location: "request", Message: err.Error()}}
+}
+
+func fieldErrors(location, field, reason string, err error) []FieldError {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		var result []FieldError
+		for _, inner := range e {
+			result = append(result, fieldErrors(location, field, reason, inner)...)
+		}
+		return result
+	case *openapi3.SchemaError:
+		path := e.JSONPointer()
+		if field != "" {
+			path = append([]string{field}, path...)
+		}
+		message := e.Reason
+		if message == "" && e.Origin != nil {
+			message = e.Origin.Error()
+		}
+		return []FieldError{{Location: location, Field: strings.Join(path, "."), Message: message}}
+	case *openapi3filter.ParseError:
+		message := e.Reason
+		if message == "" {
+			message = reason
+		}
+		return []FieldError{{Location: location, Field: field, Message: message}}
+	}
+	if reason == "" {
+		reason = err.Error()
+	}
+	return []FieldError{{Location: location, Field: field, Message: reason}}
+}
+
+func msgpackBodyDecoder(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn openapi3filter.EncodingFn) (any, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	b, err = codec.MsgpackToJSON(b)
+	if err != nil {
+		return nil, err
+	}
+	return openapi3filter.JSONBodyDecoder(bytes.NewReader(b), header, schema, encFn)
+}
@@ -0,0 +1,283 @@
+// Package rpc implements the wire formats of the gRPC-Web and Connect unary
+// protocols, so browser clients generated from the upstream protos can call
+// the gateway without an extra proxy.
+package rpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	MIMEGRPCWeb      = "application/grpc-web"
+	MIMEGRPCWebProto = "application/grpc-web+proto"
+	MIMEGRPCWebText  = "application/grpc-web-text"
+	MIMEGRPCWebTextP = "application/grpc-web-text+proto"
+	MIMEConnectProto = "application/proto"
+	MIMEConnectJSON  = "application/json"
+
+	// Frame flags of gRPC-Web messages.
+	flagData    byte = 0x00
+	flagTrailer byte = 0x80
+)
+
+var (
+	ErrUnsupportedMediaType = errors.New("unsupported content type")
+	ErrMalformedFrame       = errors.New("malformed gRPC-Web frame")
+	ErrMessageTooLarge      = errors.New("message is too large")
+)
+
+type Protocol int
+
+const (
+	GRPCWeb Protocol = iota
+	GRPCWebText
+	ConnectProto
+	ConnectJSON
+)
+
+// Detect returns the protocol of a request by its Content-Type.
+func Detect(contentType string) (Protocol, error) {
+	switch strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0])) {
+	case MIMEGRPCWeb, MIMEGRPCWebProto:
+		return GRPCWeb, nil
+	case MIMEGRPCWebText, MIMEGRPCWebTextP:
+		return GRPCWebText, nil
+	case MIMEConnectProto:
+		return ConnectProto, nil
+	case MIMEConnectJSON:
+		return ConnectJSON, nil
+	}
+	return 0, ErrUnsupportedMediaType
+}
+
+func (p Protocol) IsGRPCWeb() bool {
+	return p == GRPCWeb || p == GRPCWebText
+}
+
+// ContentType is the Content-Type of responses.
+func (p Protocol) ContentType() string {
+	switch p {
+	case GRPCWeb:
+		return MIMEGRPCWebProto
+	case GRPCWebText:
+		return MIMEGRPCWebTextP
+	case ConnectProto:
+		return MIMEConnectProto
+	}
+	return MIMEConnectJSON
+}
+
+// ReadMessage reads the request message: the raw body for Connect and the
+// first data frame for gRPC-Web. Bodies over limit bytes are rejected.
+func ReadMessage(p Protocol, body io.Reader, limit int64) ([]byte, error) {
+	raw, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(raw)) > limit {
+		return nil, ErrMessageTooLarge
+	}
+	if !p.IsGRPCWeb() {
+		return raw, nil
+	}
+	if p == GRPCWebText {
+		if raw, err = decodeText(raw); err != nil {
+			return nil, ErrMalformedFrame
+		}
+	}
+	if len(raw) < 5 || raw[0]&flagTrailer != 0 {
+		return nil, ErrMalformedFrame
+	}
+	if raw[0] != flagData {
+		return nil, status.Error(codes.Unimplemented, "compressed messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(raw[1:5])
+	if uint64(len(raw)-5) < uint64(n) {
+		return nil, ErrMalformedFrame
+	}
+	return raw[5 : 5+n], nil
+}
+
+// WriteGRPCWeb writes a gRPC-Web response: the message frame, if any, and
+// the trailer frame with the status. Errors are sent in the trailer, so the
+// HTTP status is always 200.
+func WriteGRPCWeb(w http.ResponseWriter, p Protocol, header metadata.MD, msg []byte, err error) {
+	for k, values := range header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	w.Header().Set("Content-Type", p.ContentType())
+	w.WriteHeader(http.StatusOK)
+
+	var body bytes.Buffer
+	if err == nil {
+		writeFrame(&body, flagData, msg)
+	}
+	st := status.Convert(err)
+	var trailer bytes.Buffer
+	fmt.Fprintf(&trailer, "grpc-status: %d\r\n", st.Code())
+	if st.Message() != "" {
+		fmt.Fprintf(&trailer, "grpc-message: %s\r\n", encodeMessage(st.Message()))
+	}
+	writeFrame(&body, flagTrailer, trailer.Bytes())
+
+	if p == GRPCWebText {
+		w.Write([]byte(base64.StdEncoding.EncodeToString(body.Bytes())))
+		return
+	}
+	w.Write(body.Bytes())
+}
+
+// WriteConnect writes a Connect unary response. Errors are sent as JSON with
+// the HTTP status of their code.
+func WriteConnect(w http.ResponseWriter, p Protocol, header metadata.MD, msg []byte, err error) {
+	for k, values := range header {
+		for _, v := range values {
+			w.Header().Add(k, v)
+		}
+	}
+	if err != nil {
+		st := status.Convert(err)
+		body, _ := json.Marshal(map[string]string{"code": CodeName(st.Code()), "message": st.Message()})
+		w.Header().Set("Content-Type", MIMEConnectJSON)
+		w.WriteHeader(HTTPStatus(st.Code()))
+		w.Write(body)
+		return
+	}
+	w.Header().Set("Content-Type", p.ContentType())
+	w.WriteHeader(http.StatusOK)
+	w.Write(msg)
+}
+
+// Timeout parses the grpc-timeout (gRPC-Web) or Connect-Timeout-Ms header.
+func Timeout(p Protocol, header http.Header) (time.Duration, bool) {
+	if !p.IsGRPCWeb() {
+		ms, err := strconv.ParseInt(header.Get("Connect-Timeout-Ms"), 10, 64)
+		if err != nil || ms <= 0 {
+			return 0, false
+		}
+		return time.Duration(ms) * time.Millisecond, true
+	}
+
+	v := header.Get("Grpc-Timeout")
+	if len(v) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second, 'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, ok := units[v[len(v)-1]]
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// CodeName is the Connect name of a code, e.g. "not_found".
+func CodeName(code codes.Code) string {
+	if code == codes.Canceled {
+		return "canceled"
+	}
+	var b strings.Builder
+	for i, r := range code.String() {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// HTTPStatus maps a code to the HTTP status of the Connect protocol.
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	}
+	return http.StatusInternalServerError
+}
+
+func writeFrame(w *bytes.Buffer, flag byte, msg []byte) {
+	var prefix [5]byte
+	prefix[0] = flag
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(msg)))
+	w.Write(prefix[:])
+	w.Write(msg)
+}
+
+// decodeText decodes a grpc-web-text body, which may consist of several
+// concatenated padded base64 chunks.
+func decodeText(b []byte) ([]byte, error) {
+	b = bytes.TrimSpace(b)
+	var out []byte
+	for len(b) > 0 {
+		n := len(b)
+		if i := bytes.IndexByte(b, '='); i >= 0 {
+			n = i
+			for n < len(b) && b[n] == '=' {
+				n++
+			}
+		}
+		chunk, err := base64.StdEncoding.DecodeString(string(b[:n]))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+		b = b[n:]
+	}
+	return out, nil
+}
+
+// encodeMessage percent-encodes grpc-message as the gRPC spec requires.
+func encodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,198 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func frame(flag byte, msg []byte) []byte {
+	var b bytes.Buffer
+	writeFrame(&b, flag, msg)
+	return b.Bytes()
+}
+
+func TestReadMessage(t *testing.T) {
+	msg := []byte("hello")
+	data := frame(flagData, msg)
+	text := base64.StdEncoding.EncodeToString(data)
+
+	tests := []struct {
+		name     string
+		protocol Protocol
+		body     []byte
+		limit    int64
+		want     []byte
+		err      error
+		code     codes.Code
+	}{
+		{"connect proto", ConnectProto, msg, 64, msg, nil, codes.OK},
+		{"connect json", ConnectJSON, []byte(`{"id":1}`), 64, []byte(`{"id":1}`), nil, codes.OK},
+		{"connect at limit", ConnectProto, msg, int64(len(msg)), msg, nil, codes.OK},
+		{"connect over limit", ConnectProto, msg, int64(len(msg)) - 1, nil, ErrMessageTooLarge, codes.OK},
+		{"grpc-web", GRPCWeb, data, 64, msg, nil, codes.OK},
+		{"grpc-web trailing trailer", GRPCWeb, append(data, frame(flagTrailer, []byte("grpc-status: 0"))...), 64, msg, nil, codes.OK},
+		{"grpc-web empty message", GRPCWeb, frame(flagData, nil), 64, []byte{}, nil, codes.OK},
+		{"grpc-web short prefix", GRPCWeb, data[:4], 64, nil, ErrMalformedFrame, codes.OK},
+		{"grpc-web truncated", GRPCWeb, data[:len(data)-1], 64, nil, ErrMalformedFrame, codes.OK},
+		{"grpc-web trailer only", GRPCWeb, frame(flagTrailer, nil), 64, nil, ErrMalformedFrame, codes.OK},
+		{"grpc-web compressed", GRPCWeb, frame(0x01, msg), 64, nil, nil, codes.Unimplemented},
+		{"grpc-web over limit", GRPCWeb, data, int64(len(data)) - 1, nil, ErrMessageTooLarge, codes.OK},
+		{"grpc-web-text", GRPCWebText, []byte(text), 64, msg, nil, codes.OK},
+		{"grpc-web-text bad base64", GRPCWebText, []byte("!!!!"), 64, nil, ErrMalformedFrame, codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadMessage(tt.protocol, bytes.NewReader(tt.body), tt.limit)
+			if tt.code != codes.OK {
+				if status.Code(err) != tt.code {
+					t.Fatalf("ReadMessage() error = %v, want code %v", err, tt.code)
+				}
+				return
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("ReadMessage() error = %v, want %v", err, tt.err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ReadMessage() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	enc := base64.StdEncoding.EncodeToString
+
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{"empty", "", "", false},
+		{"unpadded chunk", enc([]byte("abc")), "abc", false},
+		{"padded chunk", enc([]byte("ab")), "ab", false},
+		{"double padding", enc([]byte("a")), "a", false},
+		{"concatenated chunks", enc([]byte("ab")) + enc([]byte("c")) + enc([]byte("def")), "abcdef", false},
+		{"surrounding whitespace", "\n " + enc([]byte("ab")) + " \r\n", "ab", false},
+		{"invalid characters", "a*b=", "", true},
+		{"truncated chunk", "YWJ", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeText([]byte(tt.in))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(got) != tt.want {
+				t.Errorf("decodeText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        Protocol
+		err         error
+	}{
+		{"application/grpc-web", GRPCWeb, nil},
+		{"application/grpc-web+proto", GRPCWeb, nil},
+		{"application/grpc-web-text; charset=utf-8", GRPCWebText, nil},
+		{"Application/Proto", ConnectProto, nil},
+		{"application/json", ConnectJSON, nil},
+		{"text/plain", 0, ErrUnsupportedMediaType},
+		{"", 0, ErrUnsupportedMediaType},
+	}
+	for _, tt := range tests {
+		t.Run(strings.ReplaceAll(tt.contentType, "/", "_"), func(t *testing.T) {
+			got, err := Detect(tt.contentType)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Detect() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Detect() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	tests := []struct {
+		protocol Protocol
+		name     string
+		value    string
+		want     time.Duration
+		ok       bool
+	}{
+		{GRPCWeb, "Grpc-Timeout", "5S", 5 * time.Second, true},
+		{GRPCWebText, "Grpc-Timeout", "250m", 250 * time.Millisecond, true},
+		{GRPCWeb, "Grpc-Timeout", "1H", time.Hour, true},
+		{GRPCWeb, "Grpc-Timeout", "5", 0, false},
+		{GRPCWeb, "Grpc-Timeout", "5x", 0, false},
+		{GRPCWeb, "Grpc-Timeout", "-5S", 0, false},
+		{GRPCWeb, "Connect-Timeout-Ms", "100", 0, false},
+		{ConnectJSON, "Connect-Timeout-Ms", "100", 100 * time.Millisecond, true},
+		{ConnectProto, "Connect-Timeout-Ms", "0", 0, false},
+		{ConnectProto, "Grpc-Timeout", "5S", 0, false},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		header.Set(tt.name, tt.value)
+		got, ok := Timeout(tt.protocol, header)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Timeout(%v, %s: %s) = %v, %v, want %v, %v", tt.protocol, tt.name, tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestWriteGRPCWeb(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteGRPCWeb(w, GRPCWeb, metadata.Pairs("x-total-count", "3"), []byte("reply"), nil)
+	want := append(frame(flagData, []byte("reply")), frame(flagTrailer, []byte("grpc-status: 0\r\n"))...)
+	if !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("body = %q, want %q", w.Body.Bytes(), want)
+	}
+	if w.Header().Get("X-Total-Count") != "3" || w.Code != http.StatusOK {
+		t.Errorf("status %d, headers %v", w.Code, w.Header())
+	}
+
+	// Errors travel in the trailer with HTTP 200 and no data frame.
+	w = httptest.NewRecorder()
+	WriteGRPCWeb(w, GRPCWebText, nil, nil, status.Error(codes.NotFound, "event 100% gone"))
+	body, err := base64.StdEncoding.DecodeString(w.Body.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = frame(flagTrailer, []byte("grpc-status: 5\r\ngrpc-message: event 100%25 gone\r\n"))
+	if !bytes.Equal(body, want) || w.Code != http.StatusOK {
+		t.Errorf("error response = %d %q, want 200 %q", w.Code, body, want)
+	}
+}
+
+func TestWriteConnect(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteConnect(w, ConnectJSON, nil, []byte(`{"id":"1"}`), nil)
+	if w.Code != http.StatusOK || w.Body.String() != `{"id":"1"}` || w.Header().Get("Content-Type") != MIMEConnectJSON {
+		t.Errorf("response = %d %s %v", w.Code, w.Body, w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	WriteConnect(w, ConnectProto, nil, nil, status.Error(codes.FailedPrecondition, "closed"))
+	if w.Code != http.StatusBadRequest || w.Body.String() != `{"code":"failed_precondition","message":"closed"}` {
+		t.Errorf("error response = %d %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Content-Type"); got != MIMEConnectJSON {
+		t.Errorf("error Content-Type = %q, want JSON for every codec", got)
+	}
+}
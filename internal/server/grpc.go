@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/handlers"
+	"github.com/Estriper0/eventhub_gateway/internal/middleware"
+	authpb "github.com/Estriper0/protobuf/gen/auth"
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// newGRPCServer serves the event and auth services to internal consumers.
+// Calls go through the same checks and side effects as their REST endpoints
+// before they are forwarded to the upstreams.
+func newGRPCServer(logger *slog.Logger, config *config.Config, rpcHandlers *handlers.RPC, verifier *apikey.Verifier) *grpc.Server {
+	methods := make(map[string]handlers.RPCMethod)
+	for _, m := range rpcHandlers.Methods() {
+		methods[m.Path] = m
+	}
+	authenticated := func(method string) bool {
+		return methods[method].Authenticated
+	}
+
+	auth := middleware.JWTAuthInterceptor(config.AccessTokenSecret, authenticated)
+	if config.APIKeys.Enabled {
+		auth = middleware.APIKeyInterceptor(verifier, config.APIKeys, authenticated, auth)
+	}
+
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(config.GRPC.MaxMessageSize),
+		grpc.ChainUnaryInterceptor(
+			middleware.RecoveryInterceptor(logger),
+			middleware.RateLimiterInterceptor(config, verifier),
+			middleware.UUIDInterceptor(),
+			middleware.LoggerInterceptor(logger),
+			auth,
+		),
+	)
+
+	for _, desc := range []grpc.ServiceDesc{pb.Event_ServiceDesc, authpb.Auth_ServiceDesc} {
+		service := grpc.ServiceDesc{
+			ServiceName: desc.ServiceName,
+			HandlerType: (*any)(nil),
+			Metadata:    desc.Metadata,
+		}
+		for _, md := range desc.Methods {
+			service.Methods = append(service.Methods, grpc.MethodDesc{
+				MethodName: md.MethodName,
+				Handler:    forward(logger, rpcHandlers, methods["/"+desc.ServiceName+"/"+md.MethodName]),
+			})
+		}
+		server.RegisterService(&service, nil)
+	}
+
+	if config.GRPC.Reflection {
+		reflection.Register(server)
+	}
+
+	return server
+}
+
+// forward decodes the request of the method and forwards it for the user
+// authenticated by the interceptors.
+func forward(logger *slog.Logger, rpcHandlers *handlers.RPC, m handlers.RPCMethod) grpc.MethodHandler {
+	return func(_ any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		in := m.NewInput()
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+
+		handler := func(ctx context.Context, req any) (any, error) {
+			userID, isAdmin := middleware.User(ctx)
+			out, header, err := rpcHandlers.Forward(ctx, m, req.(proto.Message), handlers.Caller{UserID: userID, IsAdmin: isAdmin})
+			header.Delete("content-type")
+			grpc.SetHeader(ctx, header)
+			if err != nil {
+				if _, ok := status.FromError(err); !ok {
+					logger.Error("RPC call failed", slog.String("method", m.Path), slog.String("error", err.Error()))
+					err = status.Error(codes.Internal, "Internal error")
+				}
+				return nil, err
+			}
+			return out, nil
+		}
+
+		if interceptor == nil {
+			return handler(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: rpcHandlers, FullMethod: m.Path}, handler)
+	}
+}
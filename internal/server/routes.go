@@ -3,38 +3,182 @@ package server
 import (
 	"log/slog"
 
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
 	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/feed"
 	"github.com/Estriper0/eventhub_gateway/internal/handlers"
+	"github.com/Estriper0/eventhub_gateway/internal/idempotency"
 	"github.com/Estriper0/eventhub_gateway/internal/middleware"
+	"github.com/Estriper0/eventhub_gateway/internal/session"
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine, eventHandlers *handlers.Event, authHandlers *handlers.Auth, logger *slog.Logger, config *config.Config) {
-	r.Use(cors.Default())
-	r.Use(middleware.RecoveryMiddleware(logger))
-	r.Use(middleware.RateLimiterMiddleware(config))
+// routeDeps are the handlers and services the routes are set up with.
+type routeDeps struct {
+	logger *slog.Logger
+	config *config.Config
+	spec   *openapi3.T
+
+	events   *handlers.Event
+	auth     *handlers.Auth
+	webhooks *handlers.Webhook
+	apiKeys  *handlers.APIKey
+	rpc      *handlers.RPC
+	// batch and graphql are created by SetupRoutes: batch needs the router.
+	batch   *handlers.Batch
+	graphql *handlers.GraphQL
+
+	responseCache    cache.Backend
+	idempotencyStore idempotency.Store
+	feeds            *feed.Signer
+	refresher        *session.Refresher
+	verifier         *apikey.Verifier
+}
+
+func SetupRoutes(r *gin.Engine, deps routeDeps) {
+	config := deps.config
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowAllOrigins = true
+	// gRPC-Web and Connect clients send their own headers and read the status from headers.
+	corsConfig.AddAllowHeaders("Authorization", "X-Grpc-Web", "X-User-Agent", "Grpc-Timeout", "Connect-Protocol-Version", "Connect-Timeout-Ms")
+	corsConfig.AddExposeHeaders("Grpc-Status", "Grpc-Message")
+	if config.APIKeys.Enabled {
+		corsConfig.AddAllowHeaders(config.APIKeys.Header)
+	}
+	if config.Session.Enabled {
+		corsConfig.AddAllowHeaders(config.Session.CSRFHeader)
+		// Cookies are only sent cross-origin with credentials, which can't be allowed for every origin.
+		if len(config.Session.AllowedOrigins) > 0 {
+			corsConfig.AllowAllOrigins = false
+			corsConfig.AllowOrigins = config.Session.AllowedOrigins
+			corsConfig.AllowCredentials = true
+		}
+	}
+	r.Use(cors.New(corsConfig))
+	r.Use(middleware.RecoveryMiddleware(deps.logger))
+	r.Use(middleware.RateLimiterMiddleware(config, deps.verifier))
 	r.Use(middleware.UUIDMiddleware())
-	r.Use(middleware.LoggerMiddleware(logger))
+	r.Use(middleware.LoggerMiddleware(deps.logger))
+	r.Use(middleware.CSRFMiddleware(config.Session))
+	r.Use(middleware.CompressionMiddleware(config.Compression))
+	r.Use(middleware.DeprecationMiddleware(config.Versioning.Deprecations))
+
+	deps.batch = handlers.NewBatch(deps.logger, config, r)
+	deps.idempotencyStore = idempotency.NewMemoryStore()
+	deps.graphql = handlers.NewGraphQL(deps.logger, config, deps.events, deps.responseCache)
+
+	setupV1(r.Group("v1"), &deps)
+
+	if config.RPC.Enabled {
+		rpc := r.Group(config.RPC.Prefix)
+		for _, method := range deps.rpc.Methods() {
+			chain := []gin.HandlerFunc{deps.rpc.Handle(method)}
+			if method.Authenticated {
+				chain = append([]gin.HandlerFunc{authenticate(&deps, "rpc")}, chain...)
+			}
+			rpc.POST(method.Path, chain...)
+		}
+	}
+
+	// Unversioned aliases of v1, kept until clients migrate to /v1.
+	if config.Versioning.Unversioned {
+		setupV1(r.Group(""), &deps)
+	}
+}
+
+func setupV1(r *gin.RouterGroup, deps *routeDeps) {
+	config := deps.config
+	validator := middleware.ValidationMiddleware(deps.spec, r.BasePath())
+	idempotent := middleware.IdempotencyMiddleware(deps.idempotencyStore, config.Idempotency)
+	jwtAuth := middleware.JWTAuthMiddleware(config.AccessTokenSecret, config.Session, deps.refresher)
 
 	events := r.Group("events")
-	events.Use(middleware.JWTAuthMiddleware(config.AccessTokenSecret))
-	events.GET("/", eventHandlers.GetAll)
-	events.GET("/status/:status", eventHandlers.GetAllByStatus)
-	events.GET("/creator/:creator", eventHandlers.GetAllByCreator)
-	events.GET("/:id/users", eventHandlers.GetAllUsersByEvent)
-	events.GET("/:id", eventHandlers.GetById)
-	events.POST("/", eventHandlers.Create)
-	events.DELETE("/:id", eventHandlers.DeleteById)
-	events.PUT("/", eventHandlers.Update)
-	events.GET("/me", eventHandlers.GetAllByUser)
-	events.POST("/:id/register", eventHandlers.Register)
-	events.DELETE("/:id/register", eventHandlers.CancellRegister)
+	// Calendar feeds accept feed tokens, so they are served outside the
+	// JWT-protected group. feeds is nil without a valid FEED_TOKEN_SECRET.
+	if deps.feeds != nil {
+		feedAuth := middleware.FeedAuthMiddleware(deps.feeds, config.AccessTokenSecret, config.Session, deps.refresher)
+		calendar := r.Group("events")
+		calendar.GET("/me.ics", feedAuth, deps.events.GetAllByUserCalendar)
+		events.Use(middleware.ExtensionMiddleware("id", ".ics", feedAuth, deps.events.GetByIdCalendar))
+	}
+	events.Use(authenticate(deps, "events"))
+	events.Use(validator)
+	events.Use(middleware.CacheMiddleware(deps.responseCache, "events", r.BasePath(), config.Cache))
+	events.GET("/", deps.events.GetAll)
+	events.GET("/status/:status", deps.events.GetAllByStatus)
+	events.GET("/creator/:creator", deps.events.GetAllByCreator)
+	events.GET("/:id/users", deps.events.GetAllUsersByEvent)
+	events.GET("/:id", deps.events.GetById)
+	events.POST("/", idempotent, deps.events.Create)
+	events.DELETE("/:id", deps.events.DeleteById)
+	events.PUT("/", deps.events.Update)
+	events.PUT("/:id", deps.events.UpdateById)
+	events.PATCH("/:id", deps.events.Patch)
+	events.GET("/me", deps.events.GetAllByUser)
+	events.GET("/stream", deps.events.Stream)
+	events.GET("/:id/stream", deps.events.StreamById)
+	if deps.feeds != nil {
+		events.POST("/me/feed", deps.events.CreateFeed)
+		events.DELETE("/me/feed", deps.events.RevokeFeed)
+	}
+	events.POST("/register", idempotent, deps.events.RegisterMany)
+	events.POST("/:id/register", idempotent, deps.events.Register)
+	events.DELETE("/:id/register", deps.events.CancellRegister)
+
+	webhooks := r.Group("webhooks")
+	webhooks.Use(authenticate(deps, "webhooks"))
+	webhooks.Use(validator)
+	webhooks.POST("/", deps.webhooks.Create)
+	webhooks.GET("/", deps.webhooks.GetAll)
+	webhooks.GET("/dead-letters", deps.webhooks.DeadLetters)
+	webhooks.POST("/deliveries/:id/replay", deps.webhooks.Replay)
+	webhooks.GET("/:id", deps.webhooks.GetById)
+	webhooks.DELETE("/:id", deps.webhooks.DeleteById)
+	webhooks.GET("/:id/deliveries", deps.webhooks.Deliveries)
+
+	// Sub-requests are authenticated on their own with the inherited Authorization header.
+	r.POST("/batch", validator, deps.batch.Batch)
+
+	graphql := r.Group("graphql")
+	graphql.Use(authenticate(deps, "graphql"))
+	graphql.Use(validator)
+	graphql.GET("", deps.graphql.GraphQL)
+	graphql.POST("", deps.graphql.GraphQL)
+
+	// The websocket authenticates itself: browsers can't set headers on the handshake.
+	r.GET("/ws", deps.events.WebSocket)
+
+	// Keys are managed with a JWT only, so that a leaked key can't issue others.
+	if config.APIKeys.Enabled {
+		apiKeys := r.Group("api-keys")
+		apiKeys.Use(jwtAuth)
+		apiKeys.Use(validator)
+		apiKeys.POST("/", deps.apiKeys.Create)
+		apiKeys.GET("/", deps.apiKeys.GetAll)
+		apiKeys.GET("/:id", deps.apiKeys.GetById)
+		apiKeys.POST("/:id/rotate", deps.apiKeys.Rotate)
+		apiKeys.DELETE("/:id", deps.apiKeys.DeleteById)
+	}
 
 	auth := r.Group("auth")
-	auth.POST("/register", authHandlers.Register)
-	auth.POST("/login", authHandlers.Login)
-	auth.POST("/admin", authHandlers.IsAdmin)
-	auth.POST("/refresh", authHandlers.Refresh)
-	auth.POST("/logout", authHandlers.Logout)
+	auth.Use(validator)
+	auth.POST("/register", deps.auth.Register)
+	auth.POST("/login", deps.auth.Login)
+	auth.POST("/admin", deps.auth.IsAdmin)
+	auth.POST("/refresh", deps.auth.Refresh)
+	auth.POST("/logout", deps.auth.Logout)
+}
+
+// authenticate accepts API keys with scopes of the resource when they are
+// enabled and JWTs otherwise.
+func authenticate(deps *routeDeps, resource string) gin.HandlerFunc {
+	config := deps.config
+	jwtAuth := middleware.JWTAuthMiddleware(config.AccessTokenSecret, config.Session, deps.refresher)
+	if !config.APIKeys.Enabled {
+		return jwtAuth
+	}
+	return middleware.APIKeyMiddleware(deps.verifier, config.APIKeys, resource, jwtAuth)
 }
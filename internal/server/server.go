@@ -2,20 +2,37 @@ package server
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
-	"time"
 
+	"github.com/Estriper0/eventhub_gateway/api"
+	"github.com/Estriper0/eventhub_gateway/internal/apikey"
+	"github.com/Estriper0/eventhub_gateway/internal/cache"
 	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/Estriper0/eventhub_gateway/internal/feed"
 	"github.com/Estriper0/eventhub_gateway/internal/handlers"
+	"github.com/Estriper0/eventhub_gateway/internal/session"
+	"github.com/Estriper0/eventhub_gateway/internal/watch"
+	"github.com/Estriper0/eventhub_gateway/internal/webhook"
+	"github.com/Estriper0/eventhub_gateway/internal/ws"
 	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
 )
 
 type Server struct {
 	httpServer *http.Server
-	logger     *slog.Logger
-	config     *config.Config
+	// debugServer serves /debug/vars on an internal address; nil if disabled.
+	debugServer *http.Server
+	grpcServer  *grpc.Server
+	hub         *watch.Hub
+	sockets     *ws.Manager
+	webhooks    *webhook.Dispatcher
+	verifier    *apikey.Verifier
+	logger      *slog.Logger
+	config      *config.Config
 }
 
 func New(logger *slog.Logger, config *config.Config) *Server {
@@ -25,24 +42,126 @@ func New(logger *slog.Logger, config *config.Config) *Server {
 
 	router := gin.New()
 
-	eventHandlers := handlers.NewEvent(logger, config)
-	authHandlers := handlers.NewAuth(logger, config)
-	
-	SetupRoutes(router, eventHandlers, authHandlers, logger, config)
+	var feedStore feed.Store = feed.NewMemoryStore()
+	if config.Calendar.RevocationsFile != "" {
+		fileStore, err := feed.NewFileStore(config.Calendar.RevocationsFile)
+		if err != nil {
+			panic(err)
+		}
+		feedStore = fileStore
+	}
+	// Without a strong secret anyone could forge feed tokens, so the calendar
+	// feeds are disabled rather than served insecurely.
+	feeds, err := feed.NewSigner(config.Calendar.FeedSecret, config.Calendar.FeedTTL, feedStore)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Calendar feeds are disabled: FEED_TOKEN_SECRET: %v", err))
+	}
+
+	hub := watch.NewHub(logger, config.Stream.PollInterval, config.Timeout, config.Stream.History, config.Stream.Buffer, config.Stream.MaxTopics)
+
+	sockets := ws.NewManager(config.WebSocket)
+
+	webhookStore := webhook.NewMemoryStore(config.Webhooks.LogSize)
+	webhooks := webhook.NewDispatcher(logger, webhookStore, config.Webhooks)
+
+	// The response cache is shared so that writes over websockets and gRPC drop cached REST responses.
+	responseCache := cache.NewLRU(config.Cache.MaxEntries)
+
+	eventHandlers := handlers.NewEvent(logger, config, feeds, hub, sockets, webhooks, responseCache)
+	webhookHandlers := handlers.NewWebhook(logger, config, webhookStore, webhooks)
+	refresher := session.NewRefresher(config)
+
+	var apiKeyStore apikey.Store = apikey.NewMemoryStore()
+	if config.APIKeys.File != "" {
+		fileStore, err := apikey.NewFileStore(config.APIKeys.File)
+		if err != nil {
+			panic(err)
+		}
+		apiKeyStore = fileStore
+	}
+	verifier := apikey.NewVerifier(apiKeyStore, config.APIKeys.LastUsedInterval)
+	apiKeyHandlers := handlers.NewAPIKey(logger, config, apiKeyStore)
+
+	authHandlers := handlers.NewAuth(logger, config, refresher)
+
+	rpcHandlers := handlers.NewRPC(logger, config, eventHandlers, responseCache)
+
+	spec, err := api.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	SetupRoutes(router, routeDeps{
+		logger:        logger,
+		config:        config,
+		spec:          spec,
+		events:        eventHandlers,
+		auth:          authHandlers,
+		webhooks:      webhookHandlers,
+		apiKeys:       apiKeyHandlers,
+		rpc:           rpcHandlers,
+		responseCache: responseCache,
+		feeds:         feeds,
+		refresher:     refresher,
+		verifier:      verifier,
+	})
 
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.Port),
 		Handler: router,
 	}
 
+	var debugServer *http.Server
+	if config.DebugVars {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		debugServer = &http.Server{
+			Addr:    config.DebugAddr,
+			Handler: mux,
+		}
+	}
+
+	var grpcServer *grpc.Server
+	if config.GRPC.Enabled {
+		grpcServer = newGRPCServer(logger, config, rpcHandlers, verifier)
+	}
+
 	return &Server{
-		httpServer: server,
-		logger:     logger,
-		config:     config,
+		httpServer:  server,
+		debugServer: debugServer,
+		grpcServer:  grpcServer,
+		hub:         hub,
+		sockets:     sockets,
+		webhooks:    webhooks,
+		verifier:    verifier,
+		logger:      logger,
+		config:      config,
 	}
 }
 
 func (s *Server) Run() {
+	if s.debugServer != nil {
+		s.logger.Info(fmt.Sprintf("Starting debug server on %s", s.debugServer.Addr))
+		go func() {
+			if err := s.debugServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
+
+	if s.grpcServer != nil {
+		lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.config.GRPC.Port))
+		if err != nil {
+			panic(err)
+		}
+		s.logger.Info(fmt.Sprintf("Starting gRPC server on %s", lis.Addr()))
+		go func() {
+			if err := s.grpcServer.Serve(lis); err != nil {
+				panic(err)
+			}
+		}()
+	}
+
 	s.logger.Info(fmt.Sprintf("Starting server on %s", s.httpServer.Addr))
 	if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		panic(err)
@@ -50,13 +169,45 @@ func (s *Server) Run() {
 }
 
 func (s *Server) Stop() error {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(s.config.Timeout))
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
 	defer cancel()
 
-	if err := s.httpServer.Shutdown(ctx); err != nil {
+	// Event streams never become idle and Shutdown doesn't track hijacked
+	// websockets, so both are ended before shutting down.
+	s.hub.Close()
+	s.sockets.Close()
+
+	if s.grpcServer != nil {
+		s.stopGRPC(ctx)
+	}
+
+	if s.debugServer != nil {
+		s.debugServer.Shutdown(ctx)
+	}
+
+	err := s.httpServer.Shutdown(ctx)
+	s.webhooks.Close()
+	s.verifier.Close()
+	if err != nil {
 		return err
 	}
 
 	s.logger.Info("Server shutdown gracefully")
 	return nil
 }
+
+// stopGRPC waits for pending calls until ctx is done and then closes the
+// remaining connections.
+func (s *Server) stopGRPC(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.grpcServer.Stop()
+	}
+}
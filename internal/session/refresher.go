@@ -0,0 +1,124 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/auth"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+var ErrNoSession = errors.New("request has no session")
+
+type refreshed struct {
+	tokens  *pb.RefreshResponse
+	expires time.Time
+}
+
+// Refresher renews the tokens of sessions with the auth-service. Concurrent
+// requests of a session share one call, and requests that still carry the
+// rotated refresh token get the same tokens during the grace period instead
+// of being rejected by the auth-service.
+type Refresher struct {
+	config     config.Session
+	timeout    time.Duration
+	authClient pb.AuthClient
+	group      singleflight.Group
+
+	mu     sync.Mutex
+	recent map[string]refreshed
+}
+
+func NewRefresher(config *config.Config) *Refresher {
+	conn, err := grpc.NewClient(fmt.Sprintf("%s:%d", config.Auth.Host, config.Auth.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		panic(err)
+	}
+
+	return &Refresher{
+		config:     config.Session,
+		timeout:    config.Timeout,
+		authClient: pb.NewAuthClient(conn),
+		recent:     make(map[string]refreshed),
+	}
+}
+
+// Refresh renews the session of the request, sets the rotated cookies and
+// returns the new access token. The session cookies are deleted if the
+// auth-service rejects the refresh token.
+func (r *Refresher) Refresh(c *gin.Context) (string, error) {
+	refreshToken := RefreshToken(c, r.config)
+	if refreshToken == "" {
+		return "", ErrNoSession
+	}
+
+	tokens, err := r.Renew(c.Request.Context(), refreshToken)
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			End(c, r.config)
+		}
+		return "", err
+	}
+
+	Start(c, r.config, tokens.AccessToken, tokens.RefreshToken)
+	return tokens.AccessToken, nil
+}
+
+// Renew exchanges the refresh token for new tokens.
+func (r *Refresher) Renew(ctx context.Context, refreshToken string) (*pb.RefreshResponse, error) {
+	r.mu.Lock()
+	res, ok := r.recent[refreshToken]
+	r.mu.Unlock()
+	if ok && time.Now().Before(res.expires) {
+		return res.tokens, nil
+	}
+
+	// The shared call is detached from the request that started it, so that
+	// its cancellation doesn't fail the others.
+	ch := r.group.DoChan(refreshToken, func() (any, error) {
+		callCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), r.timeout)
+		defer cancel()
+
+		tokens, err := r.authClient.Refresh(callCtx, &pb.RefreshRequest{RefreshToken: refreshToken})
+		if err != nil {
+			return nil, err
+		}
+		r.remember(refreshToken, tokens)
+		return tokens, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.(*pb.RefreshResponse), nil
+	}
+}
+
+func (r *Refresher) remember(refreshToken string, tokens *pb.RefreshResponse) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for k, res := range r.recent {
+		if now.After(res.expires) {
+			delete(r.recent, k)
+		}
+	}
+	r.recent[refreshToken] = refreshed{
+		tokens:  tokens,
+		expires: now.Add(r.config.RefreshGrace),
+	}
+}
@@ -0,0 +1,141 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	pb "github.com/Estriper0/protobuf/gen/auth"
+	"github.com/gin-gonic/gin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAuthClient rotates refresh tokens "r<n>" to "r<n>'"; the other calls
+// panic through the nil embedded interface.
+type fakeAuthClient struct {
+	pb.AuthClient
+	calls   atomic.Int32
+	release chan struct{}
+}
+
+func (f *fakeAuthClient) Refresh(ctx context.Context, in *pb.RefreshRequest, opts ...grpc.CallOption) (*pb.RefreshResponse, error) {
+	f.calls.Add(1)
+	if f.release != nil {
+		<-f.release
+	}
+	if in.RefreshToken == "revoked" {
+		return nil, status.Error(codes.InvalidArgument, "invalid refresh token")
+	}
+	return &pb.RefreshResponse{AccessToken: "access-" + in.RefreshToken, RefreshToken: in.RefreshToken + "'"}, nil
+}
+
+var refresherConfig = config.Session{
+	Enabled:       true,
+	AccessCookie:  "access_token",
+	RefreshCookie: "refresh_token",
+	CSRFCookie:    "csrf_token",
+	AccessTTL:     15 * time.Minute,
+	RefreshTTL:    24 * time.Hour,
+	RefreshGrace:  time.Minute,
+}
+
+func newTestRefresher(client pb.AuthClient) *Refresher {
+	return &Refresher{
+		config:     refresherConfig,
+		timeout:    time.Second,
+		authClient: client,
+		recent:     make(map[string]refreshed),
+	}
+}
+
+func TestRefresherRenew(t *testing.T) {
+	client := &fakeAuthClient{release: make(chan struct{})}
+	r := newTestRefresher(client)
+
+	// Concurrent renewals of the same refresh token share one call.
+	var wg sync.WaitGroup
+	results := make([]*pb.RefreshResponse, 5)
+	for i := range results {
+		wg.Go(func() {
+			tokens, err := r.Renew(context.Background(), "r1")
+			if err != nil {
+				t.Error(err)
+			}
+			results[i] = tokens
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+	if n := client.calls.Load(); n != 1 {
+		t.Errorf("auth-service called %d times, want 1", n)
+	}
+	for _, tokens := range results {
+		if tokens != results[0] {
+			t.Fatalf("renewals got different tokens: %v", results)
+		}
+	}
+
+	// A late request with the rotated token gets the same tokens during the
+	// grace period.
+	if tokens, _ := r.Renew(context.Background(), "r1"); tokens != results[0] || client.calls.Load() != 1 {
+		t.Errorf("renewal in the grace period = %v after %d calls", tokens, client.calls.Load())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.Renew(ctx, "r2"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Renew() with a cancelled context error = %v", err)
+	}
+}
+
+func TestRefresherRefresh(t *testing.T) {
+	r := newTestRefresher(&fakeAuthClient{})
+
+	request := func(refreshToken string) (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/events/", nil)
+		if refreshToken != "" {
+			c.Request.AddCookie(&http.Cookie{Name: "refresh_token", Value: refreshToken})
+		}
+		return c, w
+	}
+	cookies := func(w *httptest.ResponseRecorder) map[string]string {
+		m := make(map[string]string)
+		for _, c := range w.Result().Cookies() {
+			m[c.Name] = c.Value
+		}
+		return m
+	}
+
+	c, w := request("r1")
+	accessToken, err := r.Refresh(c)
+	if err != nil || accessToken != "access-r1" {
+		t.Fatalf("Refresh() = %q, %v", accessToken, err)
+	}
+	if got := cookies(w); got["access_token"] != "access-r1" || got["refresh_token"] != "r1'" {
+		t.Errorf("cookies = %v, want the rotated tokens", got)
+	}
+
+	c, w = request("revoked")
+	if _, err := r.Refresh(c); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Refresh() of a revoked token error = %v", err)
+	}
+	if got := cookies(w); len(got) != 3 || got["refresh_token"] != "" {
+		t.Errorf("cookies = %v, want the session ended", got)
+	}
+
+	c, _ = request("")
+	if _, err := r.Refresh(c); !errors.Is(err, ErrNoSession) {
+		t.Errorf("Refresh() without a refresh cookie error = %v, want %v", err, ErrNoSession)
+	}
+}
@@ -0,0 +1,114 @@
+// Package session keeps the tokens of browser clients in cookies: the refresh
+// token and a short-lived access token in HttpOnly cookies and a CSRF token in
+// a cookie readable by scripts, which must be echoed in a header on
+// state-changing requests (double-submit).
+package session
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+// Start sets the session cookies and returns the CSRF token. The CSRF token
+// of a running session is kept, so that other tabs don't lose it on refresh.
+func Start(c *gin.Context, config config.Session, accessToken, refreshToken string) string {
+	csrf, err := c.Cookie(config.CSRFCookie)
+	if err != nil || csrf == "" {
+		csrf = newToken()
+	}
+
+	setCookie(c, config, config.AccessCookie, accessToken, int(config.AccessTTL.Seconds()), true)
+	setCookie(c, config, config.RefreshCookie, refreshToken, int(config.RefreshTTL.Seconds()), true)
+	setCookie(c, config, config.CSRFCookie, csrf, int(config.RefreshTTL.Seconds()), false)
+	return csrf
+}
+
+// End deletes the session cookies.
+func End(c *gin.Context, config config.Session) {
+	for _, name := range []string{config.AccessCookie, config.RefreshCookie, config.CSRFCookie} {
+		setCookie(c, config, name, "", -1, name != config.CSRFCookie)
+	}
+}
+
+// AccessToken returns the access token of the session or "" if there is none.
+func AccessToken(c *gin.Context, config config.Session) string {
+	return cookie(c, config, config.AccessCookie)
+}
+
+// RefreshToken returns the refresh token of the session or "" if there is none.
+func RefreshToken(c *gin.Context, config config.Session) string {
+	return cookie(c, config, config.RefreshCookie)
+}
+
+// Active reports whether the request carries a session cookie.
+func Active(c *gin.Context, config config.Session) bool {
+	return AccessToken(c, config) != "" || RefreshToken(c, config) != ""
+}
+
+// CheckCSRF reports whether the CSRF header matches the CSRF cookie.
+func CheckCSRF(c *gin.Context, config config.Session) bool {
+	csrf := cookie(c, config, config.CSRFCookie)
+	header := c.GetHeader(config.CSRFHeader)
+	return csrf != "" && subtle.ConstantTimeCompare([]byte(csrf), []byte(header)) == 1
+}
+
+// AllowedOrigin reports whether the Origin of the request is the gateway
+// itself or one of the allowed origins. Websocket handshakes authenticated by
+// cookies need this check, as they aren't subject to CORS.
+func AllowedOrigin(c *gin.Context, config config.Session) bool {
+	origin := c.GetHeader("Origin")
+	if origin == "" {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && u.Host == c.Request.Host {
+		return true
+	}
+	return slices.Contains(config.AllowedOrigins, origin)
+}
+
+func cookie(c *gin.Context, config config.Session, name string) string {
+	if !config.Enabled {
+		return ""
+	}
+	value, err := c.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return value
+}
+
+func setCookie(c *gin.Context, config config.Session, name, value string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   config.Domain,
+		MaxAge:   maxAge,
+		Secure:   config.Secure,
+		HttpOnly: httpOnly,
+		SameSite: sameSite(config.SameSite),
+	})
+}
+
+func sameSite(mode string) http.SameSite {
+	switch mode {
+	case "lax":
+		return http.SameSiteLaxMode
+	case "none":
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteStrictMode
+}
+
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
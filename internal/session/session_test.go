@@ -0,0 +1,140 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckCSRF(t *testing.T) {
+	enabled := config.Session{
+		Enabled:    true,
+		CSRFCookie: "csrf_token",
+		CSRFHeader: "X-CSRF-Token",
+	}
+	disabled := enabled
+	disabled.Enabled = false
+
+	tests := []struct {
+		name   string
+		config config.Session
+		cookie string
+		header string
+		want   bool
+	}{
+		{"matching", enabled, "token", "token", true},
+		{"different", enabled, "token", "other", false},
+		{"prefix", enabled, "token", "tok", false},
+		{"no header", enabled, "token", "", false},
+		{"no cookie", enabled, "", "token", false},
+		{"neither", enabled, "", "", false},
+		{"sessions disabled", disabled, "token", "token", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPost, "/events/", nil)
+			if tt.cookie != "" {
+				c.Request.AddCookie(&http.Cookie{Name: tt.config.CSRFCookie, Value: tt.cookie})
+			}
+			if tt.header != "" {
+				c.Request.Header.Set(tt.config.CSRFHeader, tt.header)
+			}
+
+			if got := CheckCSRF(c, tt.config); got != tt.want {
+				t.Errorf("CheckCSRF() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedOrigin(t *testing.T) {
+	cfg := config.Session{AllowedOrigins: []string{"https://app.example.com"}}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"https://gateway.example.com", true},
+		{"http://gateway.example.com", true},
+		{"https://app.example.com", true},
+		{"https://app.example.com.evil.com", false},
+		{"https://evil.com", false},
+		{"null", false},
+	}
+	for _, tt := range tests {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "https://gateway.example.com/ws", nil)
+		if tt.origin != "" {
+			c.Request.Header.Set("Origin", tt.origin)
+		}
+		if got := AllowedOrigin(c, cfg); got != tt.want {
+			t.Errorf("AllowedOrigin(%q) = %v, want %v", tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	cfg := config.Session{
+		Enabled:       true,
+		AccessCookie:  "access_token",
+		RefreshCookie: "refresh_token",
+		CSRFCookie:    "csrf_token",
+		AccessTTL:     15 * time.Minute,
+		RefreshTTL:    24 * time.Hour,
+		Secure:        true,
+	}
+	cookies := func(w *httptest.ResponseRecorder) map[string]*http.Cookie {
+		m := make(map[string]*http.Cookie)
+		for _, c := range w.Result().Cookies() {
+			m[c.Name] = c
+		}
+		return m
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	csrf := Start(c, cfg, "access", "refresh")
+
+	set := cookies(w)
+	if set["access_token"].Value != "access" || !set["access_token"].HttpOnly || set["access_token"].MaxAge != 900 {
+		t.Errorf("access cookie = %+v", set["access_token"])
+	}
+	if set["refresh_token"].Value != "refresh" || !set["refresh_token"].HttpOnly {
+		t.Errorf("refresh cookie = %+v", set["refresh_token"])
+	}
+	if set["csrf_token"].Value != csrf || csrf == "" || set["csrf_token"].HttpOnly {
+		t.Errorf("CSRF cookie = %+v, want %q readable by scripts", set["csrf_token"], csrf)
+	}
+	if !set["access_token"].Secure || set["access_token"].SameSite != http.SameSiteStrictMode {
+		t.Errorf("access cookie = %+v, want Secure and SameSite=Strict", set["access_token"])
+	}
+
+	// A refresh keeps the CSRF token of the running session.
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/auth/refresh", nil)
+	c.Request.AddCookie(&http.Cookie{Name: "csrf_token", Value: csrf})
+	if got := Start(c, cfg, "access2", "refresh2"); got != csrf {
+		t.Errorf("CSRF token after refresh = %q, want %q", got, csrf)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	End(c, cfg)
+	for name, cookie := range cookies(w) {
+		if cookie.MaxAge >= 0 || cookie.Value != "" {
+			t.Errorf("cookie %s = %+v, want it deleted", name, cookie)
+		}
+	}
+	if n := len(cookies(w)); n != 3 {
+		t.Errorf("End() set %d cookies, want 3", n)
+	}
+}
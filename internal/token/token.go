@@ -0,0 +1,37 @@
+package token
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrNotValid = errors.New("token is not valid")
+
+// ErrExpired is wrapped by the error of Parse if the token has expired.
+var ErrExpired = jwt.ErrTokenExpired
+
+// Parse verifies an HMAC-signed access token issued by the auth-service and
+// returns its claims.
+func Parse(tokenString, secretKey string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(secretKey), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, ErrNotValid
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, ErrNotValid
+	}
+	return claims, nil
+}
@@ -0,0 +1,284 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	pb "github.com/Estriper0/protobuf/gen/event"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	ChangeSnapshot = "snapshot"
+	ChangeCreated  = "created"
+	ChangeUpdated  = "updated"
+	ChangeDeleted  = "deleted"
+)
+
+var (
+	ErrClosed        = errors.New("hub is closed")
+	ErrTooManyTopics = errors.New("too many topics are watched")
+)
+
+// Change is a change of the watched events. Snapshot changes carry the whole
+// current state in Events, the others a single event in Event; for deleted
+// events it is the last known state.
+type Change struct {
+	ID     uint64
+	Type   string
+	Event  *pb.EventElem
+	Events []*pb.EventElem
+}
+
+// Source returns the current state of a topic. A topic whose events no longer
+// exist returns an empty slice rather than an error.
+type Source func(ctx context.Context) ([]*pb.EventElem, error)
+
+// Hub detects changes by polling sources and fans them out to subscribers.
+// Subscribers of the same topic share one poller, which stops when the last
+// of them leaves. The event-service has no streaming RPCs, so polling with
+// diffing is the only way to learn about changes.
+type Hub struct {
+	logger   *slog.Logger
+	interval time.Duration
+	timeout  time.Duration
+	history  int
+	buffer   int
+	// maxTopics bounds the pollers, each of which calls the event-service
+	// every interval; 0 means no limit.
+	maxTopics int
+
+	mu     sync.Mutex
+	seq    uint64
+	topics map[string]*topic
+	closed bool
+}
+
+type topic struct {
+	state   map[int64]*pb.EventElem
+	ready   bool
+	history []Change
+	subs    map[*Subscription]struct{}
+	cancel  context.CancelFunc
+}
+
+// Subscription receives the changes of a topic on C. C is closed when the
+// subscriber falls more than the buffer behind or the hub is closed.
+type Subscription struct {
+	C <-chan Change
+
+	c      chan Change
+	hub    *Hub
+	key    string
+	closed bool
+}
+
+// NewHub creates a Hub that polls every interval with the given per-poll
+// timeout, keeps the last history changes of every topic for resumption,
+// buffers up to buffer changes per subscriber and watches at most maxTopics
+// topics at once.
+func NewHub(logger *slog.Logger, interval, timeout time.Duration, history, buffer, maxTopics int) *Hub {
+	return &Hub{
+		logger:    logger,
+		interval:  interval,
+		timeout:   timeout,
+		history:   history,
+		buffer:    buffer,
+		maxTopics: maxTopics,
+		topics:    make(map[string]*topic),
+	}
+}
+
+// Subscribe subscribes to the topic key, starting its poller with source if
+// needed. If resume is set and the changes after lastID are still in the
+// history, they are returned as backlog; otherwise the backlog is a snapshot
+// of the current state (or empty, if the first poll hasn't finished yet and
+// the snapshot will arrive on C). Subscribing to a new topic fails with
+// ErrTooManyTopics if maxTopics are already watched.
+func (h *Hub) Subscribe(key string, source Source, lastID uint64, resume bool) (*Subscription, []Change, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, nil, ErrClosed
+	}
+
+	t, ok := h.topics[key]
+	if !ok {
+		if h.maxTopics > 0 && len(h.topics) >= h.maxTopics {
+			return nil, nil, ErrTooManyTopics
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		t = &topic{
+			state:  make(map[int64]*pb.EventElem),
+			subs:   make(map[*Subscription]struct{}),
+			cancel: cancel,
+		}
+		h.topics[key] = t
+		go h.run(ctx, key, t, source)
+	}
+
+	c := make(chan Change, h.buffer)
+	sub := &Subscription{C: c, c: c, hub: h, key: key}
+	t.subs[sub] = struct{}{}
+
+	if !t.ready {
+		return sub, nil, nil
+	}
+	if resume && lastID <= h.seq && len(t.history) > 0 && lastID+1 >= t.history[0].ID {
+		var backlog []Change
+		for _, change := range t.history {
+			if change.ID > lastID {
+				backlog = append(backlog, change)
+			}
+		}
+		return sub, backlog, nil
+	}
+	return sub, []Change{h.snapshot(t)}, nil
+}
+
+// Close unsubscribes. It is safe to call more than once.
+func (s *Subscription) Close() {
+	h := s.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if t, ok := h.topics[s.key]; ok {
+		delete(t.subs, s)
+		if len(t.subs) == 0 {
+			t.cancel()
+			delete(h.topics, s.key)
+		}
+	}
+	s.close()
+}
+
+func (s *Subscription) close() {
+	if !s.closed {
+		s.closed = true
+		close(s.c)
+	}
+}
+
+// Close stops all pollers and closes all subscriptions.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for key, t := range h.topics {
+		t.cancel()
+		for sub := range t.subs {
+			sub.close()
+		}
+		delete(h.topics, key)
+	}
+}
+
+func (h *Hub) run(ctx context.Context, key string, t *topic, source Source) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		h.poll(ctx, key, t, source)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *Hub) poll(ctx context.Context, key string, t *topic, source Source) {
+	pollCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	events, err := source(pollCtx)
+	if err != nil {
+		if ctx.Err() == nil {
+			h.logger.Warn("Polling for changes failed", slog.String("topic", key), slog.String("error", err.Error()))
+		}
+		return
+	}
+
+	state := make(map[int64]*pb.EventElem, len(events))
+	for _, e := range events {
+		state[e.Id] = e
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	if !t.ready {
+		t.state = state
+		t.ready = true
+		h.broadcast(t, h.snapshot(t))
+		return
+	}
+
+	for _, id := range sortedIDs(state) {
+		old, ok := t.state[id]
+		switch {
+		case !ok:
+			h.record(t, Change{Type: ChangeCreated, Event: state[id]})
+		case !proto.Equal(old, state[id]):
+			h.record(t, Change{Type: ChangeUpdated, Event: state[id]})
+		}
+	}
+	for _, id := range sortedIDs(t.state) {
+		if _, ok := state[id]; !ok {
+			h.record(t, Change{Type: ChangeDeleted, Event: t.state[id]})
+		}
+	}
+	t.state = state
+}
+
+// record assigns the next ID to the change, keeps it in the history and sends
+// it to the subscribers. h.mu must be held.
+func (h *Hub) record(t *topic, change Change) {
+	h.seq++
+	change.ID = h.seq
+	t.history = append(t.history, change)
+	if len(t.history) > h.history {
+		t.history = slices.Delete(t.history, 0, len(t.history)-h.history)
+	}
+	h.broadcast(t, change)
+}
+
+// broadcast sends the change without blocking; subscribers whose buffer is
+// full are dropped and can resume from their last received ID.
+func (h *Hub) broadcast(t *topic, change Change) {
+	for sub := range t.subs {
+		select {
+		case sub.c <- change:
+		default:
+			delete(t.subs, sub)
+			sub.close()
+		}
+	}
+}
+
+func (h *Hub) snapshot(t *topic) Change {
+	events := make([]*pb.EventElem, 0, len(t.state))
+	for _, id := range sortedIDs(t.state) {
+		events = append(events, t.state[id])
+	}
+	return Change{ID: h.seq, Type: ChangeSnapshot, Events: events}
+}
+
+func sortedIDs(state map[int64]*pb.EventElem) []int64 {
+	ids := make([]int64, 0, len(state))
+	for id := range state {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
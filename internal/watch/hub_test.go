@@ -0,0 +1,229 @@
+package watch
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	pb "github.com/Estriper0/protobuf/gen/event"
+)
+
+// fakeSource returns whatever state the test set last.
+type fakeSource struct {
+	mu     sync.Mutex
+	events []*pb.EventElem
+	polls  int
+}
+
+func (s *fakeSource) set(events ...*pb.EventElem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = events
+}
+
+func (s *fakeSource) source(ctx context.Context) ([]*pb.EventElem, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polls++
+	return slices.Clone(s.events), nil
+}
+
+func newTestHub(history int) *Hub {
+	return NewHub(slog.New(slog.NewTextHandler(io.Discard, nil)), 10*time.Millisecond, time.Second, history, 16, 0)
+}
+
+func receive(t *testing.T, sub *Subscription) Change {
+	t.Helper()
+	select {
+	case change, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return change
+	case <-time.After(time.Second):
+		t.Fatal("no change received")
+	}
+	return Change{}
+}
+
+func TestHubChanges(t *testing.T) {
+	hub := newTestHub(10)
+	defer hub.Close()
+	src := &fakeSource{}
+	src.set(&pb.EventElem{Id: 1, Title: "Go"}, &pb.EventElem{Id: 2, Title: "Rust"})
+
+	sub, backlog, err := hub.Subscribe("events", src.source, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	if len(backlog) != 0 {
+		t.Fatalf("backlog before the first poll = %v", backlog)
+	}
+
+	snapshot := receive(t, sub)
+	if snapshot.Type != ChangeSnapshot || len(snapshot.Events) != 2 {
+		t.Fatalf("first change = %+v, want a snapshot of 2 events", snapshot)
+	}
+
+	src.set(&pb.EventElem{Id: 1, Title: "Go meetup"}, &pb.EventElem{Id: 3, Title: "Elm"})
+	want := []struct {
+		typ string
+		id  int64
+	}{
+		{ChangeUpdated, 1},
+		{ChangeCreated, 3},
+		{ChangeDeleted, 2},
+	}
+	var lastID uint64
+	for _, w := range want {
+		change := receive(t, sub)
+		if change.Type != w.typ || change.Event.Id != w.id {
+			t.Errorf("change = %s %d, want %s %d", change.Type, change.Event.Id, w.typ, w.id)
+		}
+		if change.ID <= lastID {
+			t.Errorf("change ID %d after %d", change.ID, lastID)
+		}
+		lastID = change.ID
+	}
+}
+
+func TestHubResume(t *testing.T) {
+	hub := newTestHub(2)
+	defer hub.Close()
+	src := &fakeSource{}
+
+	first, _, err := hub.Subscribe("events", src.source, 0, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	receive(t, first)
+
+	var ids []uint64
+	for i := range 3 {
+		src.set(&pb.EventElem{Id: 1, MaxAttendees: int32(i + 1)})
+		ids = append(ids, receive(t, first).ID)
+	}
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		resume bool
+		types  []string
+		ids    []uint64
+	}{
+		{"no Last-Event-ID", 0, false, []string{ChangeSnapshot}, []uint64{ids[2]}},
+		{"within history", ids[0], true, []string{ChangeUpdated, ChangeUpdated}, ids[1:]},
+		{"up to date", ids[2], true, nil, nil},
+		{"older than history", ids[0] - 1, true, []string{ChangeSnapshot}, []uint64{ids[2]}},
+		{"unknown future ID", ids[2] + 100, true, []string{ChangeSnapshot}, []uint64{ids[2]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, backlog, err := hub.Subscribe("events", src.source, tt.lastID, tt.resume)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sub.Close()
+
+			var types []string
+			var got []uint64
+			for _, change := range backlog {
+				types = append(types, change.Type)
+				got = append(got, change.ID)
+			}
+			if !slices.Equal(types, tt.types) || !slices.Equal(got, tt.ids) {
+				t.Errorf("backlog = %v %v, want %v %v", types, got, tt.types, tt.ids)
+			}
+		})
+	}
+}
+
+func TestHubSharesPoller(t *testing.T) {
+	hub := newTestHub(10)
+	defer hub.Close()
+	src := &fakeSource{}
+
+	a, _, _ := hub.Subscribe("events", src.source, 0, false)
+	b, _, _ := hub.Subscribe("events", src.source, 0, false)
+	receive(t, a)
+	receive(t, b)
+	time.Sleep(50 * time.Millisecond)
+	a.Close()
+	b.Close()
+	b.Close()
+
+	src.mu.Lock()
+	polls := src.polls
+	src.mu.Unlock()
+	// One poller ran every 10ms for about 50ms; two would double that.
+	if polls > 8 {
+		t.Errorf("source polled %d times, want one poller", polls)
+	}
+
+	hub.mu.Lock()
+	topics := len(hub.topics)
+	hub.mu.Unlock()
+	if topics != 0 {
+		t.Errorf("%d topics left after the last subscriber closed", topics)
+	}
+}
+
+func TestHubMaxTopics(t *testing.T) {
+	hub := NewHub(slog.New(slog.NewTextHandler(io.Discard, nil)), 10*time.Millisecond, time.Second, 10, 16, 1)
+	defer hub.Close()
+	src := &fakeSource{}
+
+	if _, _, err := hub.Subscribe("events/1", src.source, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := hub.Subscribe("events/1", src.source, 0, false); err != nil {
+		t.Errorf("Subscribe() to a watched topic error = %v", err)
+	}
+	if _, _, err := hub.Subscribe("events/2", src.source, 0, false); err != ErrTooManyTopics {
+		t.Errorf("Subscribe() over the limit error = %v, want %v", err, ErrTooManyTopics)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	hub := newTestHub(10)
+	src := &fakeSource{}
+	sub, _, _ := hub.Subscribe("events", src.source, 0, false)
+	hub.Close()
+
+	for range sub.C {
+	}
+	sub.Close()
+	if _, _, err := hub.Subscribe("events", src.source, 0, false); err != ErrClosed {
+		t.Errorf("Subscribe() after Close error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	l := NewLimiter(2)
+	if !l.Acquire("u1") || !l.Acquire("u1") {
+		t.Fatal("Acquire() under the limit failed")
+	}
+	if l.Acquire("u1") {
+		t.Error("Acquire() over the limit succeeded")
+	}
+	if !l.Acquire("u2") {
+		t.Error("limit is shared between users")
+	}
+	l.Release("u1")
+	if !l.Acquire("u1") {
+		t.Error("Acquire() after Release failed")
+	}
+
+	unlimited := NewLimiter(0)
+	for range 100 {
+		if !unlimited.Acquire("u1") {
+			t.Fatal("Acquire() with no limit failed")
+		}
+	}
+}
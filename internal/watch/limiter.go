@@ -0,0 +1,40 @@
+package watch
+
+import "sync"
+
+// Limiter limits the number of concurrent connections per user.
+type Limiter struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int
+}
+
+// NewLimiter creates a Limiter; max <= 0 disables the limit.
+func NewLimiter(max int) *Limiter {
+	return &Limiter{
+		max:    max,
+		counts: make(map[string]int),
+	}
+}
+
+// Acquire reserves a connection for the user and reports whether the limit
+// allowed it. Every successful Acquire must be followed by Release.
+func (l *Limiter) Acquire(userID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.max > 0 && l.counts[userID] >= l.max {
+		return false
+	}
+	l.counts[userID]++
+	return true
+}
+
+func (l *Limiter) Release(userID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.counts[userID]--; l.counts[userID] <= 0 {
+		delete(l.counts, userID)
+	}
+}
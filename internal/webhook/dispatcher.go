@@ -0,0 +1,315 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	mathrand "math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+)
+
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+var ErrNotDead = errors.New("delivery is not dead")
+
+// Dispatcher delivers notifications to the subscriptions with a pool of
+// workers. Failed deliveries are retried with exponential backoff and jitter
+// until MaxAttempts, then moved to the dead-letter list.
+type Dispatcher struct {
+	logger *slog.Logger
+	store  Store
+	config config.Webhooks
+	client *http.Client
+
+	queue  chan string
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+func NewDispatcher(logger *slog.Logger, store Store, config config.Webhooks) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		logger: logger,
+		store:  store,
+		config: config,
+		client: &http.Client{
+			Timeout: config.Timeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		queue:  make(chan string, config.Queue),
+		ctx:    ctx,
+		cancel: cancel,
+		timers: make(map[string]*time.Timer),
+	}
+
+	for range config.Workers {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Publish enqueues a delivery of the event to every subscription selecting
+// it. data becomes the data field of the payload.
+func (d *Dispatcher) Publish(event string, data json.RawMessage) {
+	subscriptions, err := d.store.Subscriptions()
+	if err != nil {
+		d.logger.Error("Listing webhook subscriptions failed", slog.String("error", err.Error()))
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, sub := range subscriptions {
+		if !slices.Contains(sub.Events, event) {
+			continue
+		}
+
+		id := NewID("dlv_")
+		payload, err := json.Marshal(map[string]any{
+			"id":         id,
+			"type":       event,
+			"created_at": now,
+			"data":       data,
+		})
+		if err != nil {
+			d.logger.Error("Encoding webhook payload failed", slog.String("error", err.Error()))
+			return
+		}
+
+		delivery := &Delivery{
+			ID:             id,
+			SubscriptionID: sub.ID,
+			Event:          event,
+			Payload:        payload,
+			Status:         StatusPending,
+			CreatedAt:      now,
+		}
+		if err := d.store.SaveDelivery(delivery); err != nil {
+			d.logger.Error("Saving webhook delivery failed", slog.String("error", err.Error()))
+			continue
+		}
+		d.enqueue(id)
+	}
+}
+
+// Replay sends a dead delivery again with a fresh set of attempts. Its
+// attempt log is kept.
+func (d *Dispatcher) Replay(id string) (*Delivery, error) {
+	delivery, err := d.store.Delivery(id)
+	if err != nil {
+		return nil, err
+	}
+	if delivery.Status != StatusDead {
+		return nil, ErrNotDead
+	}
+
+	delivery.Status = StatusPending
+	delivery.Tries = 0
+	delivery.NextAttemptAt = time.Time{}
+	if err := d.store.SaveDelivery(delivery); err != nil {
+		return nil, err
+	}
+	d.enqueue(id)
+	return delivery, nil
+}
+
+// Close stops the workers and pending retries, waiting for deliveries in
+// progress. Deliveries that are still pending stay in the store.
+func (d *Dispatcher) Close() {
+	d.cancel()
+
+	d.mu.Lock()
+	for id, timer := range d.timers {
+		timer.Stop()
+		delete(d.timers, id)
+	}
+	d.mu.Unlock()
+
+	d.wg.Wait()
+}
+
+// enqueue hands the delivery to a worker without blocking the caller; if the
+// queue is full, the delivery is retried later like a failed one.
+func (d *Dispatcher) enqueue(id string) {
+	select {
+	case d.queue <- id:
+	default:
+		d.schedule(id, d.config.Backoff)
+	}
+}
+
+func (d *Dispatcher) schedule(id string, delay time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.ctx.Err() != nil {
+		return
+	}
+	d.timers[id] = time.AfterFunc(delay, func() {
+		d.mu.Lock()
+		delete(d.timers, id)
+		d.mu.Unlock()
+
+		select {
+		case d.queue <- id:
+		case <-d.ctx.Done():
+		}
+	})
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case id := <-d.queue:
+			d.deliver(id)
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(id string) {
+	delivery, err := d.store.Delivery(id)
+	if err != nil || delivery.Status != StatusPending {
+		return
+	}
+	sub, err := d.store.Subscription(delivery.SubscriptionID)
+	if err != nil {
+		return
+	}
+
+	attempt := d.send(sub, delivery)
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Tries++
+
+	switch {
+	case attempt.Error == "" && attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		delivery.Status = StatusSucceeded
+		delivery.NextAttemptAt = time.Time{}
+	case delivery.Tries >= d.config.MaxAttempts:
+		delivery.Status = StatusDead
+		delivery.NextAttemptAt = time.Time{}
+		d.logger.Warn(
+			"Webhook delivery moved to dead letters",
+			slog.String("delivery_id", delivery.ID),
+			slog.String("subscription_id", sub.ID),
+		)
+	default:
+		delay := d.backoff(delivery.Tries)
+		delivery.NextAttemptAt = time.Now().Add(delay).UTC()
+		defer d.schedule(id, delay)
+	}
+
+	if err := d.store.SaveDelivery(delivery); err != nil && !errors.Is(err, ErrNotFound) {
+		d.logger.Error("Saving webhook delivery failed", slog.String("error", err.Error()))
+	}
+}
+
+func (d *Dispatcher) send(sub *Subscription, delivery *Delivery) Attempt {
+	start := time.Now()
+	attempt := Attempt{At: start.UTC()}
+
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "EventHub-Webhooks/1.0")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, start.Unix(), delivery.Payload))
+
+	resp, err := d.client.Do(req)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	attempt.StatusCode = resp.StatusCode
+	return attempt
+}
+
+// backoff returns the delay before the try after the given number of tries:
+// Backoff doubled per try, capped at MaxBackoff, with ±20% jitter.
+func (d *Dispatcher) backoff(tries int) time.Duration {
+	delay := d.config.Backoff << min(tries-1, 30)
+	if delay <= 0 || delay > d.config.MaxBackoff {
+		delay = d.config.MaxBackoff
+	}
+	jitter := 0.8 + 0.4*mathrand.Float64()
+	return time.Duration(float64(delay) * jitter)
+}
+
+// Sign returns the signature header value: the timestamp and the hex
+// HMAC-SHA256 of "<timestamp>.<body>" keyed with the subscription secret.
+// Receivers should recompute it and reject stale timestamps.
+func Sign(secret string, timestamp int64, body []byte) string {
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, signature(secret, timestamp, body))
+}
+
+// Verify checks a signature header value produced by Sign and returns its
+// timestamp.
+func Verify(secret, header string, body []byte) (time.Time, bool) {
+	var timestamp int64
+	var sig string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			sig = value
+		}
+	}
+	if timestamp == 0 || sig == "" {
+		return time.Time{}, false
+	}
+	expected := signature(secret, timestamp, body)
+	return time.Unix(timestamp, 0), hmac.Equal([]byte(sig), []byte(expected))
+}
+
+func signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewID returns a random identifier with the given prefix.
+func NewID(prefix string) string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"slices"
+	"sync"
+)
+
+// MemoryStore keeps subscriptions and deliveries in process memory. Only the
+// last logSize deliveries of every subscription are kept; pending and dead
+// ones are never dropped.
+type MemoryStore struct {
+	mu            sync.Mutex
+	logSize       int
+	subscriptions map[string]*Subscription
+	deliveries    map[string]*Delivery
+	// order holds delivery IDs per subscription, oldest first.
+	order map[string][]string
+}
+
+func NewMemoryStore(logSize int) *MemoryStore {
+	return &MemoryStore{
+		logSize:       logSize,
+		subscriptions: make(map[string]*Subscription),
+		deliveries:    make(map[string]*Delivery),
+		order:         make(map[string][]string),
+	}
+}
+
+func (s *MemoryStore) SaveSubscription(sub *Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.subscriptions[sub.ID] = copySubscription(sub)
+	return nil
+}
+
+func (s *MemoryStore) Subscription(id string) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copySubscription(sub), nil
+}
+
+func (s *MemoryStore) Subscriptions() ([]*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*Subscription, 0, len(s.subscriptions))
+	for _, sub := range s.subscriptions {
+		result = append(result, copySubscription(sub))
+	}
+	slices.SortFunc(result, func(a, b *Subscription) int {
+		return a.CreatedAt.Compare(b.CreatedAt)
+	})
+	return result, nil
+}
+
+func (s *MemoryStore) DeleteSubscription(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.subscriptions, id)
+	for _, deliveryID := range s.order[id] {
+		delete(s.deliveries, deliveryID)
+	}
+	delete(s.order, id)
+	return nil
+}
+
+func (s *MemoryStore) SaveDelivery(d *Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscriptions[d.SubscriptionID]; !ok {
+		return ErrNotFound
+	}
+	if _, ok := s.deliveries[d.ID]; !ok {
+		s.order[d.SubscriptionID] = append(s.order[d.SubscriptionID], d.ID)
+	}
+	s.deliveries[d.ID] = copyDelivery(d)
+	s.trim(d.SubscriptionID)
+	return nil
+}
+
+func (s *MemoryStore) Delivery(id string) (*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return copyDelivery(d), nil
+}
+
+func (s *MemoryStore) Deliveries(subscriptionID string) ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := s.order[subscriptionID]
+	result := make([]*Delivery, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		result = append(result, copyDelivery(s.deliveries[ids[i]]))
+	}
+	return result, nil
+}
+
+func (s *MemoryStore) DeadLetters() ([]*Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []*Delivery
+	for _, d := range s.deliveries {
+		if d.Status == StatusDead {
+			result = append(result, copyDelivery(d))
+		}
+	}
+	slices.SortFunc(result, func(a, b *Delivery) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return result, nil
+}
+
+// trim drops the oldest succeeded deliveries of a subscription above logSize.
+// Dead deliveries are kept until replayed, so that a burst of successes can't
+// push them out of the dead-letter list.
+func (s *MemoryStore) trim(subscriptionID string) {
+	ids := s.order[subscriptionID]
+	excess := len(ids) - s.logSize
+	if excess <= 0 {
+		return
+	}
+	kept := ids[:0]
+	for _, id := range ids {
+		if excess > 0 && s.deliveries[id].Status == StatusSucceeded {
+			delete(s.deliveries, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.order[subscriptionID] = kept
+}
+
+func copySubscription(sub *Subscription) *Subscription {
+	c := *sub
+	c.Events = slices.Clone(sub.Events)
+	return &c
+}
+
+func copyDelivery(d *Delivery) *Delivery {
+	c := *d
+	c.Attempts = slices.Clone(d.Attempts)
+	return &c
+}
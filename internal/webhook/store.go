@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	EventCreated          = "event.created"
+	EventUpdated          = "event.updated"
+	EventDeleted          = "event.deleted"
+	RegistrationCreated   = "registration.created"
+	RegistrationCancelled = "registration.cancelled"
+)
+
+// EventTypes lists the event types a subscription can select.
+var EventTypes = []string{EventCreated, EventUpdated, EventDeleted, RegistrationCreated, RegistrationCancelled}
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusDead      = "dead"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type Subscription struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Delivery is one notification for one subscription. Deliveries that used up
+// their attempts are dead and stay in the dead-letter list until replayed.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	// Tries counts the attempts since the delivery was created or replayed.
+	Tries         int       `json:"tries"`
+	Attempts      []Attempt `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at,omitzero"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+}
+
+// Store keeps subscriptions and deliveries. Implementations return copies,
+// so callers may modify the results.
+type Store interface {
+	SaveSubscription(s *Subscription) error
+	Subscription(id string) (*Subscription, error)
+	Subscriptions() ([]*Subscription, error)
+	DeleteSubscription(id string) error
+
+	SaveDelivery(d *Delivery) error
+	Delivery(id string) (*Delivery, error)
+	// Deliveries returns the deliveries of a subscription, newest first.
+	Deliveries(subscriptionID string) ([]*Delivery, error)
+	// DeadLetters returns the dead deliveries of all subscriptions, newest first.
+	DeadLetters() ([]*Delivery, error)
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"event":"event.created"}`)
+	header := Sign("secret", 1700000000, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		ok     bool
+	}{
+		{"valid", "secret", header, body, true},
+		{"spaces after comma", "secret", fmt.Sprintf("t=1700000000, v1=%s", signature("secret", 1700000000, body)), body, true},
+		{"wrong secret", "other", header, body, false},
+		{"changed body", "secret", header, []byte(`{"event":"event.deleted"}`), false},
+		{"changed timestamp", "secret", fmt.Sprintf("t=1700000001,v1=%s", signature("secret", 1700000000, body)), body, false},
+		{"no timestamp", "secret", "v1=" + signature("secret", 1700000000, body), body, false},
+		{"no signature", "secret", "t=1700000000", body, false},
+		{"empty", "secret", "", body, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, ok := Verify(tt.secret, tt.header, tt.body)
+			if ok != tt.ok {
+				t.Fatalf("Verify() ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && !at.Equal(time.Unix(1700000000, 0)) {
+				t.Errorf("Verify() timestamp = %v, want %v", at, time.Unix(1700000000, 0))
+			}
+		})
+	}
+}
+
+func TestMemoryStoreTrim(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []string
+		kept     []string
+	}{
+		{"under limit", []string{StatusSucceeded, StatusSucceeded}, []string{"d0", "d1"}},
+		{"oldest succeeded dropped", []string{StatusSucceeded, StatusSucceeded, StatusSucceeded, StatusSucceeded}, []string{"d2", "d3"}},
+		{"pending kept", []string{StatusPending, StatusSucceeded, StatusSucceeded, StatusSucceeded}, []string{"d0", "d3"}},
+		{"dead kept", []string{StatusDead, StatusDead, StatusSucceeded, StatusSucceeded}, []string{"d0", "d1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore(2)
+			if err := s.SaveSubscription(&Subscription{ID: "sub"}); err != nil {
+				t.Fatal(err)
+			}
+			for i, status := range tt.statuses {
+				d := &Delivery{ID: fmt.Sprintf("d%d", i), SubscriptionID: "sub", Status: status}
+				if err := s.SaveDelivery(d); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, id := range tt.kept {
+				if _, err := s.Delivery(id); err != nil {
+					t.Errorf("Delivery(%q) error = %v", id, err)
+				}
+			}
+			if got := len(s.order["sub"]); got != len(tt.kept) {
+				t.Errorf("kept %d deliveries, want %d", got, len(tt.kept))
+			}
+		})
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	fail := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if _, ok := Verify("secret", r.Header.Get(SignatureHeader), body); !ok {
+			t.Errorf("delivery %s has an invalid signature", r.Header.Get(DeliveryHeader))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header.Get(EventHeader))
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	store := NewMemoryStore(10)
+	d := NewDispatcher(slog.New(slog.NewTextHandler(io.Discard, nil)), store, config.Webhooks{
+		Workers:     2,
+		Queue:       10,
+		Timeout:     time.Second,
+		MaxAttempts: 3,
+		Backoff:     time.Millisecond,
+		MaxBackoff:  5 * time.Millisecond,
+	})
+	defer d.Close()
+	store.SaveSubscription(&Subscription{ID: "sub", URL: srv.URL, Events: []string{EventCreated}, Secret: "secret"})
+
+	d.Publish(EventDeleted, json.RawMessage(`{}`))
+	d.Publish(EventCreated, json.RawMessage(`{"event_id":1}`))
+
+	dead := waitFor(t, func() []*Delivery {
+		dead, _ := store.DeadLetters()
+		return dead
+	})
+	if dead[0].Tries != 3 || len(dead[0].Attempts) != 3 || dead[0].Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("dead delivery = %+v, want 3 failed attempts", dead[0])
+	}
+	var payload map[string]any
+	if err := json.Unmarshal(dead[0].Payload, &payload); err != nil || payload["type"] != EventCreated || payload["id"] != dead[0].ID {
+		t.Errorf("payload = %s", dead[0].Payload)
+	}
+
+	if _, err := d.Replay("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Replay(unknown) error = %v, want %v", err, ErrNotFound)
+	}
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if _, err := d.Replay(dead[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	replayed := waitFor(t, func() []*Delivery {
+		delivery, _ := store.Delivery(dead[0].ID)
+		if delivery.Status != StatusSucceeded {
+			return nil
+		}
+		return []*Delivery{delivery}
+	})
+	if len(replayed[0].Attempts) != 4 || replayed[0].Tries != 1 {
+		t.Errorf("replayed delivery has %d attempts and %d tries, want 4 and 1", len(replayed[0].Attempts), replayed[0].Tries)
+	}
+	if _, err := d.Replay(dead[0].ID); !errors.Is(err, ErrNotDead) {
+		t.Errorf("Replay() of a succeeded delivery error = %v, want %v", err, ErrNotDead)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 4 || slices.Contains(received, EventDeleted) {
+		t.Errorf("received %v, want 4 deliveries of %s only", received, EventCreated)
+	}
+}
+
+func waitFor(t *testing.T, poll func() []*Delivery) []*Delivery {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if result := poll(); len(result) > 0 {
+			return result
+		}
+	}
+	t.Fatal("timed out")
+	return nil
+}
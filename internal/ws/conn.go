@@ -0,0 +1,212 @@
+package ws
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Estriper0/eventhub_gateway/internal/config"
+	"github.com/gorilla/websocket"
+)
+
+var ErrClosed = errors.New("websocket manager is closed")
+
+// Manager upgrades connections and keeps track of them, so that they can be
+// closed with 1001 Going Away when the server stops. http.Server.Shutdown
+// doesn't wait for hijacked connections on its own.
+type Manager struct {
+	config   config.WebSocket
+	upgrader websocket.Upgrader
+
+	mu     sync.Mutex
+	conns  map[*Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewManager(config config.WebSocket) *Manager {
+	return &Manager{
+		config: config,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: config.WriteWait,
+			Subprotocols:     config.Subprotocols,
+			// Only handshakes authenticated by cookies need the origin check,
+			// which the handler makes.
+			CheckOrigin: func(r *http.Request) bool {
+				return true
+			},
+		},
+		conns: make(map[*Conn]struct{}),
+	}
+}
+
+// Conn is a websocket connection with a bounded send queue drained by its own
+// writer goroutine, which also sends keepalive pings.
+type Conn struct {
+	conn    *websocket.Conn
+	config  config.WebSocket
+	manager *Manager
+
+	send      chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+	closeMsg  []byte
+}
+
+// Upgrade upgrades the HTTP connection. On failure the error response has
+// already been written, except for ErrClosed.
+func (m *Manager) Upgrade(w http.ResponseWriter, r *http.Request, header http.Header) (*Conn, error) {
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	conn, err := m.upgrader.Upgrade(w, r, header)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadLimit(m.config.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(m.config.PongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(m.config.PongWait))
+	})
+
+	c := &Conn{
+		conn:    conn,
+		config:  m.config,
+		manager: m,
+		send:    make(chan []byte, m.config.SendQueue),
+		done:    make(chan struct{}),
+	}
+
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		conn.Close()
+		return nil, ErrClosed
+	}
+	m.conns[c] = struct{}{}
+	m.wg.Add(1)
+	m.mu.Unlock()
+
+	go c.writeLoop()
+	return c, nil
+}
+
+// Close closes all connections with 1001 Going Away and waits for their
+// close frames to be written.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	conns := make([]*Conn, 0, len(m.conns))
+	for c := range m.conns {
+		conns = append(conns, c)
+	}
+	m.mu.Unlock()
+
+	for _, c := range conns {
+		c.Close(websocket.CloseGoingAway, "server is shutting down")
+	}
+	m.wg.Wait()
+}
+
+// Subprotocol returns the subprotocol negotiated during the handshake.
+func (c *Conn) Subprotocol() string {
+	return c.conn.Subprotocol()
+}
+
+// SetReadDeadline overrides the keepalive read deadline, e.g. while waiting
+// for the first message.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// Read returns the next text or binary message. Only one goroutine may read.
+func (c *Conn) Read() ([]byte, error) {
+	_, msg, err := c.conn.ReadMessage()
+	return msg, err
+}
+
+// Send queues a message without blocking. A client that doesn't keep up with
+// its queue is disconnected with 1008 Policy Violation.
+func (c *Conn) Send(msg []byte) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		c.Close(websocket.ClosePolicyViolation, "send queue is full")
+		return false
+	}
+}
+
+// Close sends a close frame with the code and reason once the queue is
+// flushed and closes the connection. Only the first call has an effect.
+func (c *Conn) Close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeMsg = websocket.FormatCloseMessage(code, reason)
+		close(c.done)
+	})
+}
+
+// Done is closed when the connection starts closing.
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) writeLoop() {
+	ticker := time.NewTicker(c.config.PingInterval)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+
+		c.manager.mu.Lock()
+		delete(c.manager.conns, c)
+		c.manager.mu.Unlock()
+		c.manager.wg.Done()
+	}()
+
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				c.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.config.WriteWait)); err != nil {
+				c.Close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-c.done:
+			c.flush()
+			c.conn.WriteControl(websocket.CloseMessage, c.closeMsg, time.Now().Add(c.config.WriteWait))
+			return
+		}
+	}
+}
+
+// flush writes the messages that were queued before the connection started
+// closing, e.g. the error that explains the close.
+func (c *Conn) flush() {
+	for {
+		select {
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(c.config.WriteWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}